@@ -0,0 +1,77 @@
+package rangetripper
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathEscapeError is returned when the output path isn't within the SetBaseDir directory
+type PathEscapeError struct {
+	// Base is the directory the output path must be within
+	Base string
+	// Path is the output path
+	Path string
+}
+
+// Error returns the stringified version of PathEscapeError
+func (e PathEscapeError) Error() string {
+	return fmt.Sprintf("output path '%s' escapes the base directory '%s'", e.Path, e.Base)
+}
+
+// SetBaseDir confines the output file to “dir“, for when the output path comes from somewhere untrusted, e.g.
+// part of a URL. A relative output path is taken relative to “dir“, and RoundTrip returns a PathEscapeError
+// without writing anything if the result, with any “..“ or symlinks resolved, isn't within “dir“, or is a
+// symlink to a file that doesn't exist yet, which creating the file would follow. As New
+// checks the directory of the output path as given, relative to the working directory, it is simplest to
+// give New “filepath.Join(dir, path)“, which this catches any escape from. An empty “dir“ disables it.
+func (rt *RangeTripper) SetBaseDir(dir string) {
+	rt.baseDir = dir
+}
+
+// confineOutput resolves the output path within the base directory, if set, or returns a PathEscapeError.
+func (rt *RangeTripper) confineOutput() error {
+	if rt.baseDir == "" {
+		return nil
+	}
+
+	base, err := filepath.Abs(rt.baseDir)
+	if err != nil {
+		return err
+	} else if base, err = filepath.EvalSymlinks(base); err != nil {
+		return err
+	}
+
+	path := rt.toFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rt.baseDir, path)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return err
+	}
+
+	// The file needn't exist yet, but if it does it may be a symlink, and its directory may be one regardless
+	resolved, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			// A dangling symlink, which creating the file would follow to wherever it points
+			return PathEscapeError{Base: rt.baseDir, Path: rt.toFile}
+		}
+		var dir string
+		if dir, err = filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+			resolved = filepath.Join(dir, filepath.Base(path))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if rel, err := filepath.Rel(base, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return PathEscapeError{Base: rt.baseDir, Path: rt.toFile}
+	}
+	rt.toFile = path
+	return nil
+}
@@ -0,0 +1,70 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_BaseDir(t *testing.T) {
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+	}))
+	defer server.Close()
+
+	var (
+		outside = t.TempDir()
+		base    = filepath.Join(t.TempDir(), "base")
+	)
+	if err := os.MkdirAll(filepath.Join(base, "sub"), 0755); err != nil {
+		panic(err)
+	} else if err = os.Symlink(outside, filepath.Join(base, "link")); err != nil {
+		panic(err)
+	} else if err = os.Symlink(filepath.Join(outside, "dangled"), filepath.Join(base, "dangling")); err != nil {
+		panic(err)
+	}
+
+	Convey("When the output path is within the base directory, the download goes there", t, func() {
+		for _, path := range []string{filepath.Join(base, "sub", "..", "ok"), "ok"} {
+			rt, err := New(4, path)
+			So(err, ShouldBeNil)
+			rt.SetBaseDir(base)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			b, err := os.ReadFile(filepath.Join(base, "ok"))
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+			So(os.Remove(filepath.Join(base, "ok")), ShouldBeNil)
+		}
+	})
+
+	Convey("When the output path escapes the base directory, nothing is written, and a PathEscapeError is returned", t, func() {
+		for _, path := range []string{filepath.Join(base, "..", "escaped"), filepath.Join(base, "link", "escaped"), filepath.Join(outside, "escaped"), filepath.Join(base, "dangling")} {
+			rt, err := New(4, path)
+			So(err, ShouldBeNil)
+			rt.SetBaseDir(base)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			var pe PathEscapeError
+			So(errors.As(rerr, &pe), ShouldBeTrue)
+			So(pe.Path, ShouldEqual, path)
+			So(pe.Base, ShouldEqual, base)
+			So(rt.RequestCount(), ShouldEqual, 0)
+
+			_, err = os.Stat(path)
+			So(errors.Is(err, os.ErrNotExist), ShouldBeTrue)
+		}
+	})
+}
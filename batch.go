@@ -0,0 +1,86 @@
+package rangetripper
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// batchWorkers is how many chunks each DownloadBatch download is divided into, unless a Job's Configure says
+// otherwise
+const batchWorkers = 10
+
+// Job is one download for DownloadBatch
+type Job struct {
+	// URL is what to download
+	URL string
+	// Path is where to download it to
+	Path string
+	// Configure, if not nil, is called with the Job's RangeTripper before it starts
+	Configure func(*RangeTripper)
+}
+
+// BatchResult is the outcome of one Job in a DownloadBatch
+type BatchResult struct {
+	DownloadResult
+	// Job is the Job this is the outcome of
+	Job Job
+	// Err is the error the download returned, if any
+	Err error
+}
+
+// DownloadBatch downloads each of the “jobs“ with its own RangeTripper, no more than “maxConcurrent“ of them at
+// once, regardless of how many chunks each is divided into, and returns a BatchResult for each, in the same
+// order. A failed Job doesn't stop the others, but once “ctx“ is done, any Jobs not yet started fail with its
+// error. A “maxConcurrent“ less than 1 is taken as 1.
+func DownloadBatch(ctx context.Context, jobs []Job, maxConcurrent int) []BatchResult {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	var (
+		wg      sync.WaitGroup
+		slots   = make(chan struct{}, maxConcurrent)
+		results = make([]BatchResult, len(jobs))
+	)
+	for i, job := range jobs {
+		results[i].Job = job
+		results[i].URL = job.URL
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(result *BatchResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result.DownloadResult, result.Err = downloadJob(ctx, result.Job)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	return results
+}
+
+// downloadJob downloads the Job, returning what a RangeTripper's Wait would.
+func downloadJob(ctx context.Context, job Job) (DownloadResult, error) {
+	rt, err := New(batchWorkers, job.Path)
+	if err != nil {
+		return DownloadResult{URL: job.URL}, err
+	}
+	if job.Configure != nil {
+		job.Configure(rt)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", job.URL, nil)
+	if err != nil {
+		return DownloadResult{URL: job.URL}, err
+	}
+	rt.RoundTrip(req)
+	return rt.Wait()
+}
@@ -0,0 +1,88 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_DownloadBatch(t *testing.T) {
+	var (
+		lock      sync.Mutex
+		active    = make(map[string]int)
+		maxActive int
+	)
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// Counts the downloads, not the requests, underway at once
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		active[req.URL.Path]++
+		if len(active) > maxActive {
+			maxActive = len(active)
+		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+
+		lock.Lock()
+		if active[req.URL.Path]--; active[req.URL.Path] == 0 {
+			delete(active, req.URL.Path)
+		}
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	jobs := []Job{
+		{URL: server.URL + "/a", Path: filepath.Join(dir, "a")},
+		{URL: server.URL + "/b", Path: filepath.Join(dir, "nope", "b")},
+		{URL: server.URL + "/c", Path: filepath.Join(dir, "c"), Configure: func(rt *RangeTripper) { rt.SetChunkSize(100) }},
+		{URL: server.URL + "/d", Path: filepath.Join(dir, "d")},
+	}
+
+	Convey("When a batch is downloaded, each Job gets its own result, and no more than the limit run at once", t, func() {
+		results := DownloadBatch(context.Background(), jobs, 2)
+		So(results, ShouldHaveLength, 4)
+		So(maxActive, ShouldEqual, 2)
+
+		for i, result := range results {
+			So(result.Job.URL, ShouldEqual, jobs[i].URL)
+			So(result.URL, ShouldEqual, jobs[i].URL)
+			if i == 1 {
+				So(result.Err, ShouldNotBeNil)
+				continue
+			}
+			So(result.Err, ShouldBeNil)
+			So(result.Size, ShouldEqual, len(serverBytes))
+			So(result.Duration, ShouldBeGreaterThan, 0)
+			So(result.Ranged, ShouldBeTrue)
+
+			b, err := os.ReadFile(jobs[i].Path)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+		}
+		So(results[2].Chunks, ShouldEqual, 4)
+	})
+
+	Convey("When the batch's context is already done, no Job is started", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results := DownloadBatch(ctx, jobs, 0)
+		So(results, ShouldHaveLength, 4)
+		for _, result := range results {
+			So(result.Err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package rangetripper_test
+
+import (
+	"github.com/cognusion/go-rangetripper"
+	"github.com/cognusion/go-rangetripper/rangetrippertest"
+
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// benchSizes are the sizes of content downloaded by the benchmarks
+var benchSizes = []struct {
+	name string
+	size int
+}{
+	{"Small", 64 * 1024},
+	{"Medium", 4 * 1024 * 1024},
+	{"Large", 32 * 1024 * 1024},
+}
+
+// benchWorkers are the worker counts downloaded with by the benchmarks
+var benchWorkers = []int{1, 4, 10, 32}
+
+func BenchmarkRangeTripper(b *testing.B) {
+	for _, s := range benchSizes {
+		server := rangetrippertest.NewServer(rangetrippertest.Content(s.size))
+		for _, w := range benchWorkers {
+			b.Run(fmt.Sprintf("%s/Workers%d", s.name, w), func(b *testing.B) {
+				rangetrippertest.BenchmarkDownload(b, server.URL, int64(s.size), w, func(rt *rangetripper.RangeTripper) {
+					rt.SetClient(new(http.Client))
+				})
+			})
+		}
+		server.Close()
+	}
+}
+
+func BenchmarkRangeTripperChunkSize(b *testing.B) {
+	const size = 4 * 1024 * 1024
+	server := rangetrippertest.NewServer(rangetrippertest.Content(size))
+	defer server.Close()
+
+	for _, chunkSize := range []int64{64 * 1024, 256 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("Chunk%dK", chunkSize/1024), func(b *testing.B) {
+			rangetrippertest.BenchmarkDownload(b, server.URL, size, 10, func(rt *rangetripper.RangeTripper) {
+				rt.SetClient(new(http.Client))
+				rt.SetChunkSize(chunkSize)
+			})
+		})
+	}
+}
+
+func BenchmarkRangeTripperWriteBuffer(b *testing.B) {
+	const size = 4 * 1024 * 1024
+	server := rangetrippertest.NewServer(rangetrippertest.Content(size))
+	defer server.Close()
+
+	// 0 reads each chunk into memory before writing it, the rest stream it through a buffer
+	for _, bufSize := range []int{0, 32 * 1024, 256 * 1024} {
+		b.Run(fmt.Sprintf("Buffer%dK", bufSize/1024), func(b *testing.B) {
+			rangetrippertest.BenchmarkDownload(b, server.URL, size, 10, func(rt *rangetripper.RangeTripper) {
+				rt.SetClient(new(http.Client))
+				rt.SetWriteBufferSize(bufSize)
+			})
+		})
+	}
+}
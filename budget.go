@@ -0,0 +1,58 @@
+package rangetripper
+
+import (
+	"sync"
+)
+
+// byteBudget is a weighted semaphore measured in bytes, used to cap the number
+// of bytes being actively transferred at once.
+type byteBudget struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	max   int64
+	inUse int64
+}
+
+// newByteBudget returns a byteBudget that allows up to “max“ bytes in flight.
+func newByteBudget(max int64) *byteBudget {
+	b := &byteBudget{
+		max: max,
+	}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+// clamp ensures a single request for more than the whole budget doesn't block forever,
+// by treating it as a request for the whole budget.
+func (b *byteBudget) clamp(n int64) int64 {
+	if n > b.max {
+		return b.max
+	} else if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Acquire blocks until “n“ bytes are available in the budget, and takes them.
+func (b *byteBudget) Acquire(n int64) {
+	n = b.clamp(n)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for b.inUse+n > b.max {
+		b.cond.Wait()
+	}
+	b.inUse += n
+}
+
+// Release returns “n“ bytes to the budget. It must match a previous Acquire.
+func (b *byteBudget) Release(n int64) {
+	n = b.clamp(n)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.inUse -= n
+	b.cond.Broadcast()
+}
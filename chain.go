@@ -0,0 +1,77 @@
+package rangetripper
+
+import (
+	"context"
+	"net/http"
+)
+
+// retryStatsKey is the context key for where clientTransport puts the RetryStats of a request
+type retryStatsKey struct{}
+
+// clientTransport is an http.RoundTripper that makes requests with a Client, at the bottom of the
+// SetTransportChain middlewares.
+type clientTransport struct {
+	client Client
+}
+
+// RoundTrip makes the request with the Client, storing the RetryStats, if it is a RetryClient, where the
+// request's context says to.
+func (t clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	stats, _ := req.Context().Value(retryStatsKey{}).(*RetryStats)
+	return t.roundTrip(req, stats)
+}
+
+// roundTrip makes the request with the Client, filling in “stats“, if not nil.
+func (t clientTransport) roundTrip(req *http.Request, stats *RetryStats) (*http.Response, error) {
+	rc, ok := t.client.(*RetryClient)
+	if !ok {
+		return t.client.Do(req)
+	}
+
+	res, s, err := rc.DoWithStats(req)
+	if stats != nil {
+		*stats = s
+	}
+	return res, err
+}
+
+// SetTransportChain sets middlewares that every request RangeTripper makes, be it the probe or a chunk, passes
+// through on its way to the Client, e.g. for logging, auth, or metrics already written as RoundTrippers. The
+// first is outermost, so sees each request first. They are composed over the Client once, when the first request
+// is made, and again if SetClient is called. The Client still does the rest, so if a middleware retries, a
+// plain http.Client is a better fit than the default RetryClient. None, the default, sends requests straight to
+// the Client.
+func (rt *RangeTripper) SetTransportChain(mws ...func(http.RoundTripper) http.RoundTripper) {
+	rt.chainLock.Lock()
+	defer rt.chainLock.Unlock()
+
+	rt.chain = mws
+	rt.chained = nil
+}
+
+// dispatch sends the request through the SetTransportChain middlewares, if any, to “c“, filling in “stats“.
+func (rt *RangeTripper) dispatch(c Client, req *http.Request, stats *RetryStats) (*http.Response, error) {
+	chained := rt.chainFor(c)
+	if chained == nil {
+		return clientTransport{client: c}.roundTrip(req, stats)
+	}
+	return chained.RoundTrip(req.WithContext(context.WithValue(req.Context(), retryStatsKey{}, stats)))
+}
+
+// chainFor returns the SetTransportChain middlewares composed over “c“, or nil if there are none.
+func (rt *RangeTripper) chainFor(c Client) http.RoundTripper {
+	rt.chainLock.Lock()
+	defer rt.chainLock.Unlock()
+
+	if len(rt.chain) == 0 {
+		return nil
+	}
+	if rt.chained == nil {
+		var next http.RoundTripper = clientTransport{client: c}
+		for i := len(rt.chain) - 1; i >= 0; i-- {
+			next = rt.chain[i](next)
+		}
+		rt.chained = next
+	}
+	return rt.chained
+}
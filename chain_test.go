@@ -0,0 +1,98 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc is an http.RoundTripper that is a func
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the func
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_TransportChain(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "tc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 40)
+
+	Convey("When a transport chain is set, every request passes through each middleware, outermost first", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Authorization") != "Bearer token" {
+				rw.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		var (
+			lock  sync.Mutex
+			order []string
+		)
+		logged := func(name string) func(http.RoundTripper) http.RoundTripper {
+			return func(next http.RoundTripper) http.RoundTripper {
+				return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					lock.Lock()
+					order = append(order, name)
+					lock.Unlock()
+					return next.RoundTrip(req)
+				})
+			}
+		}
+		auth := func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req = req.Clone(req.Context())
+				req.Header.Set("Authorization", "Bearer token")
+				return next.RoundTrip(req)
+			})
+		}
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(1)
+		rt.SetTransportChain(logged("outer"), logged("inner"), auth)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(len(order), ShouldEqual, 2*rt.RequestCount())
+		for i := 0; i < len(order); i += 2 {
+			So(order[i:i+2], ShouldResemble, []string{"outer", "inner"})
+		}
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When a transport chain is set over a RetryClient, its stats still count", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(NewRetryClient(2, time.Millisecond, time.Second))
+		rt.SetTransportChain(func(next http.RoundTripper) http.RoundTripper { return next })
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(errors.Is(rerr, ForbiddenError), ShouldBeTrue)
+	})
+}
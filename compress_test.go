@@ -0,0 +1,98 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_CompressedRanges(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "compressed")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// compressing returns a server that claims to have compressed its ranged GETs, and its HEAD too if asked,
+	// and counts the ranged GETs
+	compressing := func(head bool, ranges *atomic.Int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Range") != "" {
+				ranges.Add(1)
+				if req.Header.Get("Accept-Encoding") != "identity" {
+					rw.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				rw.Header().Set("Content-Encoding", "gzip")
+			} else if head && req.Method == http.MethodHead {
+				rw.Header().Set("Content-Encoding", "gzip")
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When the first chunk is compressed, the rest aren't requested, and the content is fetched in one go", t, func() {
+		var ranges atomic.Int32
+		server := compressing(false, &ranges)
+		defer server.Close()
+
+		var reason string
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetOnFallback(func(why string) { reason = why })
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(ranges.Load(), ShouldEqual, 1)
+		So(reason, ShouldContainSubstring, "gzip")
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When the probe is compressed, no chunks are requested, and the content is fetched in one go", t, func() {
+		var ranges atomic.Int32
+		server := compressing(true, &ranges)
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(ranges.Load(), ShouldEqual, 0)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When ranges are required, and they're compressed, a CompressedRangeError is returned", t, func() {
+		for _, head := range []bool{false, true} {
+			var ranges atomic.Int32
+			server := compressing(head, &ranges)
+
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client))
+			rt.SetRequireRanges(true)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(errors.Is(rerr, CompressedRangeError), ShouldBeTrue)
+			server.Close()
+		}
+	})
+}
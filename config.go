@@ -0,0 +1,145 @@
+package rangetripper
+
+import (
+	"os"
+	"time"
+)
+
+// Config is the effective configuration of a RangeTripper, once defaults, clamps, and the interactions between
+// the Set* methods have been applied. Functions, Writers, and chans that have been set aren't included.
+type Config struct {
+	// Workers is the number of chunks to fetch, from “fileChunks“, until SetChunkSize replaces it once the
+	// length of the content is known, so after RoundTrip it is the number that were planned.
+	Workers int
+	// MaxConcurrent is how many chunks may be fetched at once (see SetMax)
+	MaxConcurrent int
+	// ChunkSize is the size of each chunk (see SetChunkSize), or 0 if the content is divided into Workers chunks
+	ChunkSize int64
+	// MaxChunks is the most chunks ChunkSize may divide the content into (see SetMaxChunks), or 0 for no limit
+	MaxChunks int
+	// WorkersMin and WorkersMax bound the number of workers ChunkSize divides the content into (see
+	// SetWorkerBounds), or are 0 if they don't
+	WorkersMin int
+	WorkersMax int
+	// KnownSize is the length of the content, if it was set with SetKnownSize, otherwise 0
+	KnownSize int64
+	// MaxContentLength is the most bytes of content that will be downloaded (see SetMaxContentLength), or 0 for
+	// no limit
+	MaxContentLength int64
+	// ParallelThreshold is the length of content below which it is fetched in one go (see SetParallelThreshold)
+	ParallelThreshold int64
+	// MaxInFlightBytes is the most bytes that may be in flight at once (see SetMaxInFlightBytes), or 0 for no limit
+	MaxInFlightBytes int64
+	// WriteBufferSize is the size of the buffer chunks are written through (see SetWriteBufferSize), or 0 if
+	// chunks are read into memory whole
+	WriteBufferSize int
+	// RangeGranularity is the multiple ranges are aligned to (see SetRangeGranularity), or 0 if they aren't
+	RangeGranularity int64
+	// ReorderBufferSize is the most bytes Stream holds out of order (see SetReorderBufferSize), or 0 for no limit.
+	// It doesn't apply to WriteParts, which hands each chunk to the PartWriter as it is fetched.
+	ReorderBufferSize int64
+	// WriteOffset is where in the output file the content starts (see SetWriteOffset)
+	WriteOffset int64
+
+	// Timeout bounds the whole of RoundTrip (see SetTimeout), or 0 if it isn't
+	Timeout time.Duration
+	// ChunkDeadline bounds each attempt at a chunk (see SetChunkDeadline), or 0 if it isn't
+	ChunkDeadline time.Duration
+	// FirstByteTimeout bounds the wait for each chunk to start (see SetFirstByteTimeout), or 0 if it isn't
+	FirstByteTimeout time.Duration
+	// ChunkRetries is how many times a failed chunk is retried (see SetChunkRetries)
+	ChunkRetries int
+	// HeadFakeRetries is how many times a faked HEAD is retried (see SetHeadFakeRetries)
+	HeadFakeRetries int
+	// ShrinkRestarts is how many times the download restarts if the content shrinks (see SetShrinkRestarts)
+	ShrinkRestarts int
+	// MismatchRetries is how many times the download is retried if a chunk mismatches (see SetRetryOnMismatch)
+	MismatchRetries int
+
+	// RequireRanges is true if the download fails rather than fetching the content in one go, whether from
+	// SetRequireRanges, or because SetRanges or SetPieceManifest need ranges
+	RequireRanges bool
+	// AssumeRanges is true if ranges are assumed to be supported (see SetAssumeRanges)
+	AssumeRanges bool
+	// MinimalProbe is true if the probe is a one-byte ranged GET (see SetMinimalProbe)
+	MinimalProbe bool
+	// ShuffleChunks is true if chunks are requested in a random order (see SetShuffleChunks)
+	ShuffleChunks bool
+	// RestartOnChange is true if the download starts over when the content changes (see SetRestartOnChange)
+	RestartOnChange bool
+	// ResumeFromFileSize is true if an existing output file is resumed (see SetResumeFromFileSize)
+	ResumeFromFileSize bool
+	// VerifyDigestHeader is true if the download is checked against the probe's digest (see SetVerifyDigestHeader)
+	VerifyDigestHeader bool
+	// PreserveModTime is true if the output file gets the Last-Modified time (see SetPreserveModTime)
+	PreserveModTime bool
+	// FileBody is true if the Response's Body is the output file (see SetFileBody)
+	FileBody bool
+
+	// OutputPath is the path of the output file
+	OutputPath string
+	// BaseDir is the directory the output file is confined to (see SetBaseDir), if any
+	BaseDir string
+	// ReceiptPath is where the receipt is written (see SetWriteReceipt), if anywhere
+	ReceiptPath string
+	// DownloadID is the ID set with SetDownloadID, if any
+	DownloadID string
+	// FileMode is the permissions of the output file (see SetFileMode), or 0 if they are left to the umask
+	FileMode os.FileMode
+	// FileFlags are all of the flags the output file is opened with (see SetFileFlags)
+	FileFlags int
+	// Mirrors are the URLs set with SetMirrors, if any
+	Mirrors []string
+}
+
+// Config returns the effective configuration of the RangeTripper, as it stands, e.g. to log or to check.
+func (rt *RangeTripper) Config() Config {
+	c := Config{
+		Workers:           rt.workers,
+		MaxConcurrent:     rt.maxWorkers,
+		ChunkSize:         rt.chunkSize,
+		MaxChunks:         rt.maxChunks,
+		WorkersMin:        rt.workersMin,
+		WorkersMax:        rt.workersMax,
+		KnownSize:         rt.knownSize,
+		MaxContentLength:  rt.maxLength,
+		ParallelThreshold: rt.threshold,
+		WriteBufferSize:   rt.writeBufferSize,
+		RangeGranularity:  rt.granularity,
+		ReorderBufferSize: rt.reorderBytes,
+		WriteOffset:       rt.writeOffset,
+
+		Timeout:          rt.timeout,
+		ChunkDeadline:    rt.chunkDeadline,
+		FirstByteTimeout: rt.firstByte,
+		ChunkRetries:     rt.chunkRetries,
+		HeadFakeRetries:  rt.headFakeRetries,
+		ShrinkRestarts:   rt.shrinkRestarts,
+		MismatchRetries:  rt.mismatchRetries,
+
+		RequireRanges:      rt.requiresRanges(),
+		AssumeRanges:       rt.assumeRanges,
+		MinimalProbe:       rt.minimalProbe,
+		ShuffleChunks:      rt.shuffle,
+		RestartOnChange:    rt.restartOnChange,
+		ResumeFromFileSize: rt.resume,
+		VerifyDigestHeader: rt.verifyDigest,
+		PreserveModTime:    rt.keepMtime,
+		FileBody:           rt.fileBody,
+
+		OutputPath:  rt.toFile,
+		BaseDir:     rt.baseDir,
+		ReceiptPath: rt.receiptPath,
+		DownloadID:  rt.dlid,
+		FileMode:    rt.fileMode,
+		FileFlags:   os.O_RDWR | os.O_CREATE | rt.fileFlags,
+		Mirrors:     append([]string(nil), rt.mirrors...),
+	}
+	if rt.inFlight != nil {
+		c.MaxInFlightBytes = rt.inFlight.max
+	}
+	if rt.planned > 0 {
+		c.Workers = rt.planned
+	}
+	return c
+}
@@ -0,0 +1,73 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Config(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "cfg")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a RangeTripper is new, its Config has the defaults", t, func() {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+
+		c := rt.Config()
+		So(c.Workers, ShouldEqual, 4)
+		So(c.MaxConcurrent, ShouldEqual, 5)
+		So(c.ChunkSize, ShouldEqual, 0)
+		So(c.MaxChunks, ShouldEqual, DefaultMaxChunks)
+		So(c.ChunkRetries, ShouldEqual, DefaultChunkRetries)
+		So(c.RequireRanges, ShouldBeFalse)
+		So(c.OutputPath, ShouldEqual, tfile.Name())
+		So(c.FileFlags, ShouldEqual, os.O_RDWR|os.O_CREATE)
+	})
+
+	Convey("When settings are clamped, ignored, or implied, Config reflects what will be used", t, func() {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(0)
+		rt.SetChunkSize(-10)
+		rt.SetChunkRetries(-1)
+		rt.SetMaxInFlightBytes(1024)
+		rt.SetFileFlags(os.O_EXCL | os.O_APPEND)
+		rt.SetTimeout(time.Minute)
+		rt.SetRanges([]Range{{Start: 0, End: 10}})
+
+		c := rt.Config()
+		So(c.MaxConcurrent, ShouldEqual, 5)
+		So(c.ChunkSize, ShouldEqual, 1)
+		So(c.ChunkRetries, ShouldEqual, 0)
+		So(c.MaxInFlightBytes, ShouldEqual, 1024)
+		So(c.FileFlags, ShouldEqual, os.O_RDWR|os.O_CREATE|os.O_EXCL)
+		So(c.Timeout, ShouldEqual, time.Minute)
+		So(c.RequireRanges, ShouldBeTrue)
+	})
+
+	Convey("When a chunk size is set, Config has the number of chunks planned after RoundTrip", t, func() {
+		serverBytes := make([]byte, 1000)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(100)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(rt.Config().Workers, ShouldEqual, 10)
+	})
+}
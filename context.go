@@ -0,0 +1,91 @@
+package rangetripper
+
+import (
+	"go.uber.org/atomic"
+
+	"context"
+	"log"
+)
+
+// contextKey is a private type for keys this package stores in a context
+type contextKey int
+
+const (
+	debugLoggerKey contextKey = iota
+	timingsLoggerKey
+	requestCounterKey
+	downloadIDKey
+	outputFileKey
+)
+
+// WithDebugLogger returns a copy of the context that will cause a RangeTripper handling a Request with it
+// to send its debug messages to the specified Logger, instead of its DebugOut, which is left as it was.
+func WithDebugLogger(ctx context.Context, logger *log.Logger) context.Context {
+	return context.WithValue(ctx, debugLoggerKey, logger)
+}
+
+// WithTimingsLogger returns a copy of the context that will cause a RangeTripper handling a Request with it
+// to send its timing messages to the specified Logger, instead of its TimingsOut, which is left as it was.
+func WithTimingsLogger(ctx context.Context, logger *log.Logger) context.Context {
+	return context.WithValue(ctx, timingsLoggerKey, logger)
+}
+
+// WithDownloadID returns a copy of the context that will cause a RangeTripper handling a Request with it to
+// identify the download in its debug and timing messages with the specified ID, e.g. a trace ID, instead of
+// its own. It takes precedence over SetDownloadID.
+func WithDownloadID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, downloadIDKey, id)
+}
+
+// WithOutputFile returns a copy of the context that will cause a RangeTripper handling a Request with it to
+// download to “path“, instead of its own output file, keeping the state of that download to itself. The
+// RangeTripper's settings are shared, but it is otherwise left unused, so it can be the transport for any
+// number of Requests with their own “path“, concurrently. Its Wait, Done, Err, Config, Shutdown, and the
+// channels from its With functions, only concern its own download, not these. Any SetProgressInterval func
+// or SetProgressJSONWriter Writer is used by all of them at once.
+func WithOutputFile(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, outputFileKey, path)
+}
+
+// downloadID returns the ID to identify the download with in messages: the one in the context, if any, else
+// the one from SetDownloadID, if any, else a new one.
+func (rt *RangeTripper) downloadID(ctx context.Context) string {
+	if id, ok := ctx.Value(downloadIDKey).(string); ok && id != "" {
+		return id
+	} else if rt.dlid != "" {
+		return rt.dlid
+	}
+	return seq.NextHashID()
+}
+
+// withLoggers returns the RangeTripper, or if loggers other than its own are set in the context, a copy of it
+// using them, sharing its download, so they are only used for the one call.
+func (rt *RangeTripper) withLoggers(ctx context.Context) *RangeTripper {
+	debug, _ := ctx.Value(debugLoggerKey).(*log.Logger)
+	timings, _ := ctx.Value(timingsLoggerKey).(*log.Logger)
+	if (debug == nil || debug == rt.DebugOut) && (timings == nil || timings == rt.TimingsOut) {
+		return rt
+	}
+
+	c := *rt
+	if debug != nil {
+		c.DebugOut = debug
+	}
+	if timings != nil {
+		c.TimingsOut = timings
+	}
+	return &c
+}
+
+// withRequestCounter returns a copy of the context carrying a counter, so a Client that makes more than one
+// request for each of ours (e.g. RetryClient) can account for them with countRetry.
+func withRequestCounter(ctx context.Context, counter *atomic.Int64) context.Context {
+	return context.WithValue(ctx, requestCounterKey, counter)
+}
+
+// countRetry adds one to the counter in the context, if there is one
+func countRetry(ctx context.Context) {
+	if c, ok := ctx.Value(requestCounterKey).(*atomic.Int64); ok && c != nil {
+		c.Inc()
+	}
+}
@@ -0,0 +1,100 @@
+package rangetripper
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_ContextLoggers(t *testing.T) {
+
+	Convey("When loggers are set in the Request's context, RangeTripper uses them instead of its own", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes) // Simple write
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtctxlog")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		var (
+			ownDebug    bytes.Buffer
+			ctxDebug    bytes.Buffer
+			ctxTimings  bytes.Buffer
+			ownLogger   = log.New(&ownDebug, "", 0)
+			debugLogger = log.New(&ctxDebug, "", 0)
+			timeLogger  = log.New(&ctxTimings, "", 0)
+		)
+
+		rt, err := NewWithLoggers(10, tfile.Name(), ownLogger, ownLogger)
+		So(err, ShouldBeNil)
+
+		ctx := WithTimingsLogger(WithDebugLogger(context.Background(), debugLogger), timeLogger)
+		req := httptest.NewRequest("GET", server.URL, nil).WithContext(ctx)
+
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+		So(ownDebug.Len(), ShouldEqual, 0)
+		So(ctxDebug.String(), ShouldContainSubstring, "Finished Downloading")
+		So(ctxTimings.String(), ShouldContainSubstring, "RangeTripper Full")
+
+		Convey("... and only for that Request", func() {
+			So(rt.DebugOut, ShouldEqual, ownLogger)
+			So(rt.TimingsOut, ShouldEqual, ownLogger)
+		})
+	})
+}
+
+func Test_DownloadID(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	// Start a local HTTP server
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(serverBytes) // Simple write
+	}))
+	// Close the server when test finishes
+	defer server.Close()
+
+	tfile, err := os.CreateTemp("/tmp", "rtdlid")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a download ID is set, RangeTripper uses it in its messages", t, func() {
+		var debug bytes.Buffer
+		rt, err := NewWithLoggers(10, tfile.Name(), nil, log.New(&debug, "", 0))
+		So(err, ShouldBeNil)
+		rt.SetDownloadID("trace-1234")
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(debug.String(), ShouldContainSubstring, "[trace-1234]")
+	})
+
+	Convey("When a download ID is set in the Request's context, RangeTripper uses it instead of its own", t, func() {
+		var debug bytes.Buffer
+		rt, err := NewWithLoggers(10, tfile.Name(), nil, log.New(&debug, "", 0))
+		So(err, ShouldBeNil)
+		rt.SetDownloadID("trace-1234")
+
+		req := httptest.NewRequest("GET", server.URL, nil).WithContext(WithDownloadID(context.Background(), "span-5678"))
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+		So(debug.String(), ShouldContainSubstring, "[span-5678]")
+		So(debug.String(), ShouldNotContainSubstring, "trace-1234")
+	})
+}
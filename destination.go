@@ -0,0 +1,20 @@
+package rangetripper
+
+import (
+	"fmt"
+	"io"
+)
+
+// NonSeekableDestinationError is returned, wrapped, when the content would be downloaded in chunks, but the output
+// file can't be written out of order, e.g. because it is a named pipe. Stream fetches chunks in parallel, but
+// yields the content in order, so it can be copied to such a destination instead. Content that isn't downloaded
+// in chunks is written to it in order, as usual.
+const NonSeekableDestinationError = rtError("output file is not seekable, so the content cannot be downloaded in chunks")
+
+// checkSeekable returns a wrapped NonSeekableDestinationError if the output file can't be written out of order.
+func (rt *RangeTripper) checkSeekable() error {
+	if _, err := rt.outFile.Seek(0, io.SeekCurrent); err != nil {
+		return fmt.Errorf("%s: %w (use Stream to write it in order): %w", rt.toFile, NonSeekableDestinationError, err)
+	}
+	return nil
+}
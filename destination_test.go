@@ -0,0 +1,41 @@
+package rangetripper
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"os"
+	"testing"
+)
+
+func Test_CheckSeekable(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "destination")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+	defer tfile.Close()
+
+	Convey("When the output file is a regular file, it can be written out of order", t, func() {
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.outFile = tfile
+
+		So(rt.checkSeekable(), ShouldBeNil)
+	})
+
+	Convey("When the output file is a pipe, a NonSeekableDestinationError is returned", t, func() {
+		pr, pw, err := os.Pipe()
+		So(err, ShouldBeNil)
+		defer pr.Close()
+		defer pw.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.outFile = pw
+
+		serr := rt.checkSeekable()
+		So(errors.Is(serr, NonSeekableDestinationError), ShouldBeTrue)
+		So(serr.Error(), ShouldContainSubstring, "Stream")
+	})
+}
@@ -0,0 +1,155 @@
+package rangetripper
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DigestMismatchError is returned, wrapped, when content doesn't match the digest the server sent for it
+const DigestMismatchError = rtError("downloaded content does not match digest")
+
+// NoDigestHeaderError is returned, wrapped, by a RoundTrip with SetVerifyDigestHeader when the probe had no
+// digest to verify against. The download is otherwise complete, so it may be ignored.
+const NoDigestHeaderError = rtError("no usable digest header to verify against")
+
+// digestTrailers are the trailers that may carry a content digest: RFC 9530 “Content-Digest“, whose values
+// look like “sha-256=:base64:“, and the older RFC 3230 “Digest“, whose values look like “sha-256=base64“.
+var digestTrailers = []string{"Content-Digest", "Digest"}
+
+// contentMD5 is the header that may carry the base64 MD5 of the content, with no algorithm, as in RFC 1864
+const contentMD5 = "Content-MD5"
+
+// digestVerifier hashes content as it is written, so it can be checked against a digest trailer once the
+// body has been read.
+type digestVerifier struct {
+	hashes map[string]hash.Hash
+	md5    hash.Hash
+}
+
+// newDigestVerifier returns a digestVerifier if the Response announced a digest trailer, otherwise nil.
+func newDigestVerifier(res *http.Response) *digestVerifier {
+	if !hasDigest(res.Trailer) {
+		return nil
+	}
+	return newDigestHasher()
+}
+
+// newDigestHasher returns a digestVerifier for every algorithm we hash
+func newDigestHasher() *digestVerifier {
+	return &digestVerifier{
+		hashes: map[string]hash.Hash{
+			"sha-256": sha256.New(),
+			"sha-512": sha512.New(),
+		},
+		md5: md5.New(),
+	}
+}
+
+// hasDigest returns true if the Header has any of the digestTrailers, even with no value, as is the case for
+// trailers announced but not yet read.
+func hasDigest(h http.Header) bool {
+	for _, t := range digestTrailers {
+		if _, ok := h[t]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Writer returns a Writer that writes to “w“, and hashes what is written
+func (d *digestVerifier) Writer(w io.Writer) io.Writer {
+	ws := []io.Writer{w, d.md5}
+	for _, h := range d.hashes {
+		ws = append(ws, h)
+	}
+	return io.MultiWriter(ws...)
+}
+
+// Verify checks the hashed content against the first digest in the trailers for an algorithm we hash, or else
+// any Content-MD5. It returns false if there was nothing to check against, and a wrapped DigestMismatchError
+// if it didn't match.
+func (d *digestVerifier) Verify(trailer http.Header) (bool, error) {
+	for _, t := range digestTrailers {
+		for _, v := range trailer.Values(t) {
+			for _, entry := range strings.Split(v, ",") {
+				alg, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+				if !ok {
+					continue
+				}
+				h, ok := d.hashes[strings.ToLower(alg)]
+				if !ok {
+					continue
+				}
+				want, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":"))
+				if err != nil {
+					return true, fmt.Errorf("%s %s value is not valid base64: %w", t, alg, err)
+				}
+				if !bytes.Equal(want, h.Sum(nil)) {
+					return true, fmt.Errorf("%s %s: %w", t, alg, DigestMismatchError)
+				}
+				return true, nil
+			}
+		}
+	}
+
+	if v := trailer.Get(contentMD5); v != "" {
+		want, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return true, fmt.Errorf("%s value is not valid base64: %w", contentMD5, err)
+		} else if !bytes.Equal(want, d.md5.Sum(nil)) {
+			return true, fmt.Errorf("%s: %w", contentMD5, DigestMismatchError)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// SetVerifyDigestHeader, if true, checks the downloaded file against the digest the server sent with the probe,
+// if any, in a Content-Digest (RFC 9530), Digest (RFC 3230), or Content-MD5 header. If it doesn't match,
+// RoundTrip returns a DigestMismatchError wrapped with ValidationError. If there's no digest in an algorithm
+// we hash, RoundTrip returns a wrapped NoDigestHeaderError, which may be ignored. A ranged probe's
+// Content-Digest and Content-MD5 are of the part it returned, so only its Digest is used.
+func (rt *RangeTripper) SetVerifyDigestHeader(verify bool) {
+	rt.verifyDigest = verify
+}
+
+// verifyDigestHeader checks the output file against the digest headers of the probe Response.
+func (rt *RangeTripper) verifyDigestHeader(res *http.Response) error {
+	digests := make(http.Header)
+	if res != nil {
+		for _, t := range append(digestTrailers, contentMD5) {
+			if res.StatusCode == http.StatusPartialContent && t != "Digest" {
+				continue
+			}
+			for _, v := range res.Header.Values(t) {
+				digests.Add(t, v)
+			}
+		}
+	}
+
+	f, err := os.Open(rt.toFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dv := newDigestHasher()
+	if _, err = io.Copy(dv.Writer(io.Discard), f); err != nil {
+		return err
+	}
+	if verified, err := dv.Verify(digests); err != nil {
+		return fmt.Errorf("digest verification of %s failed: %w: %w", rt.toFile, ValidationError, err)
+	} else if !verified {
+		return fmt.Errorf("%s: %w", rt.toFile, NoDigestHeaderError)
+	}
+	return nil
+}
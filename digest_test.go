@@ -0,0 +1,164 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_DigestTrailer(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "dt")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+	sum := sha256.Sum256(serverBytes)
+	good := base64.StdEncoding.EncodeToString(sum[:])
+	bad := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	newServer := func(trailer, value string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Trailer", trailer)
+			rw.Write(serverBytes)
+			rw.Header().Set(trailer, value)
+		}))
+	}
+
+	Convey("When a server that doesn't support ranges sends a matching Content-Digest trailer, the download succeeds", t, func() {
+		server := newServer("Content-Digest", "sha-256=:"+good+":")
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+
+	Convey("When a server that doesn't support ranges sends a matching Digest trailer, the download succeeds", t, func() {
+		server := newServer("Digest", "md5=whatever, SHA-256="+good)
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+	})
+
+	Convey("When a server that doesn't support ranges sends a mismatched digest trailer, a DigestMismatchError is returned", t, func() {
+		server := newServer("Content-Digest", "sha-256=:"+bad+":")
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(errors.Is(rerr, DigestMismatchError), ShouldBeTrue)
+	})
+
+	Convey("When a server sends a digest trailer for an algorithm we don't hash, the download succeeds unverified", t, func() {
+		server := newServer("Digest", "md5=whatever")
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+	})
+}
+
+func Test_VerifyDigestHeader(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "dh")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+	sum := sha256.Sum256(serverBytes)
+	good := base64.StdEncoding.EncodeToString(sum[:])
+	md5sum := md5.Sum(serverBytes)
+	goodMD5 := base64.StdEncoding.EncodeToString(md5sum[:])
+	badMD5 := base64.StdEncoding.EncodeToString(make([]byte, md5.Size))
+
+	// newServer returns a server that sends the header with every response, and forbids HEAD if asked to
+	newServer := func(header, value string, noHead bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if noHead && req.Method == http.MethodHead {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if header != "" {
+				rw.Header().Set(header, value)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	download := func(server *httptest.Server) error {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetVerifyDigestHeader(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		return rerr
+	}
+
+	Convey("When the probe has a matching digest header, the download succeeds", t, func() {
+		for _, hv := range [][2]string{{"Content-Digest", "sha-256=:" + good + ":"}, {"Digest", "SHA-256=" + good}, {"Content-MD5", goodMD5}} {
+			server := newServer(hv[0], hv[1], false)
+			So(download(server), ShouldBeNil)
+			server.Close()
+		}
+	})
+
+	Convey("When the probe has a mismatched digest header, a DigestMismatchError is returned", t, func() {
+		server := newServer("Content-MD5", badMD5, false)
+		defer server.Close()
+
+		rerr := download(server)
+		So(errors.Is(rerr, DigestMismatchError), ShouldBeTrue)
+		So(errors.Is(rerr, ValidationError), ShouldBeTrue)
+	})
+
+	Convey("When the probe has no usable digest header, a NoDigestHeaderError is returned, but the download is complete", t, func() {
+		for _, hv := range [][2]string{{"", ""}, {"Digest", "unixsum=30637"}} {
+			server := newServer(hv[0], hv[1], false)
+			So(errors.Is(download(server), NoDigestHeaderError), ShouldBeTrue)
+			server.Close()
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+		}
+	})
+
+	Convey("When the probe is a ranged GET, only its Digest header is used", t, func() {
+		server := newServer("Content-MD5", goodMD5, true)
+		So(errors.Is(download(server), NoDigestHeaderError), ShouldBeTrue)
+		server.Close()
+
+		server = newServer("Digest", "SHA-256="+good, true)
+		So(download(server), ShouldBeNil)
+		server.Close()
+	})
+}
@@ -0,0 +1,71 @@
+package rangetripper
+
+import (
+	"io"
+)
+
+// SetRangeGranularity, if greater than 0, rounds the start of every requested range down, and the end up, to
+// multiples of “n“ bytes, for origins that refuse ranges not so aligned. The extra bytes are discarded as they
+// are read, so chunks, and the output file, are exactly as they would be otherwise. The end of the content
+// needn't be a multiple of “n“, as a range may ask for more than there is. 0 disables the rounding.
+func (rt *RangeTripper) SetRangeGranularity(n int64) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.granularity = n
+}
+
+// alignRange returns the range to request for the bytes from “start“ to “end“, rounded to the granularity.
+func (rt *RangeTripper) alignRange(start, end int64) (int64, int64) {
+	if rt.granularity == 0 {
+		return start, end
+	}
+
+	start -= start % rt.granularity
+	if rem := end % rt.granularity; rem != 0 {
+		end += rt.granularity - rem
+	}
+	return start, end
+}
+
+// trimmedBody is a Response Body that discards the first “skip“ bytes, and the “trim“ bytes after the “keep“
+// that are wanted. Anything past those is passed through, so an overrun can still be noticed.
+type trimmedBody struct {
+	io.ReadCloser
+	skip int64
+	keep int64
+	trim int64
+}
+
+// Read reads up to len(p) bytes of what's wanted into p, or of the overrun after the trim.
+func (t *trimmedBody) Read(p []byte) (int, error) {
+	if t.skip > 0 {
+		n, err := io.CopyN(io.Discard, t.ReadCloser, t.skip)
+		t.skip -= n
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	if t.keep > 0 {
+		if int64(len(p)) > t.keep {
+			p = p[:t.keep]
+		}
+		n, err := t.ReadCloser.Read(p)
+		t.keep -= int64(n)
+		return n, err
+	}
+
+	if t.trim > 0 {
+		n, err := io.CopyN(io.Discard, t.ReadCloser, t.trim)
+		t.trim -= n
+		if err != nil {
+			// Including EOF, if the content ended before the rounded-up range did
+			return 0, err
+		}
+	}
+	return t.ReadCloser.Read(p)
+}
@@ -0,0 +1,102 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_RangeGranularity(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "granularity")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// strict returns a server that refuses ranges not aligned to 64 bytes, and records those it serves
+	strict := func(lock *sync.Mutex, ranges *[]string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if rng := req.Header.Get("Range"); rng != "" {
+				var start, end int
+				if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || start%64 != 0 || (end+1)%64 != 0 {
+					rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				lock.Lock()
+				*ranges = append(*ranges, rng)
+				lock.Unlock()
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When an origin requires aligned ranges, and the granularity is set, the ranges are aligned and trimmed", t, func() {
+		for _, bufSize := range []int{0, 16} {
+			var (
+				lock   sync.Mutex
+				ranges []string
+			)
+			server := strict(&lock, &ranges)
+
+			rt, err := New(3, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetRangeGranularity(64)
+			rt.SetWriteBufferSize(bufSize)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+			So(ranges, ShouldContain, "bytes=128-319")
+			So(ranges, ShouldContain, "bytes=384-447")
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+			server.Close()
+		}
+	})
+
+	Convey("When an origin requires aligned ranges, and the granularity isn't set, the download fails", t, func() {
+		var (
+			lock   sync.Mutex
+			ranges []string
+		)
+		server := strict(&lock, &ranges)
+		defer server.Close()
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRequireRanges(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+	})
+
+	Convey("When a trimmed Body is read, only the wanted bytes come out, then any overrun", t, func() {
+		body := &trimmedBody{ReadCloser: io.NopCloser(bytes.NewReader(serverBytes[:64])), skip: 10, keep: 20, trim: 14}
+		b, err := io.ReadAll(io.LimitReader(body, 20))
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes[10:30])
+		So(overran(body), ShouldBeTrue)
+
+		body = &trimmedBody{ReadCloser: io.NopCloser(bytes.NewReader(serverBytes[:40])), skip: 10, keep: 20, trim: 14}
+		b, err = io.ReadAll(body)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes[10:30])
+
+		body = &trimmedBody{ReadCloser: io.NopCloser(bytes.NewReader(serverBytes[:5])), skip: 10, keep: 20}
+		_, err = io.ReadAll(body)
+		So(errors.Is(err, io.ErrUnexpectedEOF), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,58 @@
+package rangetripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Headers returns the response headers for the url, e.g. its Content-Length, Content-Type, ETag, and
+// Last-Modified, without downloading it, so a listing can be built before deciding what to fetch. It probes
+// the way RoundTrip does: a HEAD, falling back to a small ranged GET (see SetHeadFakeRetries) if the HEAD fails
+// or isn't answered with a 200, as happens with S3 URLs presigned for GET. The headers of a ranged GET are
+// made to describe the whole content, rather than the range. Headers doesn't count as the one request allowed
+// for this RangeTripper.
+func (rt *RangeTripper) Headers(ctx context.Context, url string) (http.Header, error) {
+	if l := rt.withLoggers(ctx); l != rt {
+		return l.Headers(ctx, url)
+	}
+
+	hres, err := rt.head(ctx, url)
+	if err == nil {
+		hres.Body.Close()
+		if hres.StatusCode == http.StatusOK {
+			return hres.Header, nil
+		}
+		err = fmt.Errorf("error during HEAD: %d / %s", hres.StatusCode, hres.Status)
+	}
+
+	hfres, hferr := rt.retryHeadFake(ctx, url)
+	if hferr != nil {
+		// headfake didn't work out, return original error
+		rt.DebugOut.Printf("Error during headFake for Headers: %v\n", hferr)
+		return nil, err
+	}
+	// Whatever the Body is, it isn't wanted
+	hfres.Body.Close()
+
+	switch hfres.StatusCode {
+	case http.StatusOK:
+		// It ignored the range, so these are the headers of the whole content
+		return hfres.Header, nil
+	case http.StatusPartialContent:
+		h := hfres.Header.Clone()
+		if total := contentRangeTotal(hfres); total >= 0 {
+			h.Set("Content-Length", strconv.FormatInt(total, 10))
+		} else {
+			h.Del("Content-Length")
+		}
+		h.Del("Content-Range")
+		if h.Get("Accept-Ranges") == "" {
+			// It honored the range, whether or not it says so
+			h.Set("Accept-Ranges", "bytes")
+		}
+		return h, nil
+	}
+	return nil, err
+}
@@ -0,0 +1,112 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Headers(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "headers")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// newServer returns a server that answers HEAD with “headStatus“, if not 0, and serves the content to a
+	// GET, counting them
+	newServer := func(headStatus int, gets *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("ETag", `"abc"`)
+			rw.Header().Set("Content-Type", "text/plain")
+			if req.Method == http.MethodHead && headStatus != 0 {
+				rw.WriteHeader(headStatus)
+				return
+			} else if req.Method == http.MethodGet {
+				atomic.AddInt32(gets, 1)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When Headers is called, the HEAD response headers are returned, and nothing is downloaded", t, func() {
+		var gets int32
+		server := newServer(0, &gets)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+
+		h, herr := rt.Headers(context.Background(), server.URL)
+		So(herr, ShouldBeNil)
+		So(h.Get("Content-Length"), ShouldEqual, strconv.Itoa(len(serverBytes)))
+		So(h.Get("ETag"), ShouldEqual, `"abc"`)
+		So(h.Get("Content-Type"), ShouldEqual, "text/plain")
+		So(atomic.LoadInt32(&gets), ShouldEqual, 0)
+
+		Convey("... and the RangeTripper can still be used for its one request", func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+		})
+	})
+
+	Convey("When the HEAD is forbidden, Headers falls back to a ranged GET, and describes the whole content", t, func() {
+		var gets int32
+		server := newServer(http.StatusForbidden, &gets)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+
+		h, herr := rt.Headers(context.Background(), server.URL)
+		So(herr, ShouldBeNil)
+		So(h.Get("Content-Length"), ShouldEqual, strconv.Itoa(len(serverBytes)))
+		So(h.Get("Content-Range"), ShouldBeEmpty)
+		So(h.Get("Accept-Ranges"), ShouldEqual, "bytes")
+		So(h.Get("ETag"), ShouldEqual, `"abc"`)
+		So(atomic.LoadInt32(&gets), ShouldEqual, 1)
+	})
+
+	Convey("When neither the HEAD nor the ranged GET work out, an error is returned", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+
+		h, herr := rt.Headers(context.Background(), server.URL)
+		So(herr, ShouldNotBeNil)
+		So(h, ShouldBeNil)
+	})
+
+	Convey("When the context is done, Headers gives up", t, func() {
+		var gets int32
+		server := newServer(0, &gets)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, herr := rt.Headers(ctx, server.URL)
+		So(herr, ShouldNotBeNil)
+	})
+}
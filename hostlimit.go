@@ -0,0 +1,82 @@
+package rangetripper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+)
+
+var (
+	hostSlotsLock sync.Mutex
+	hostLimit     int
+	hostSlots     = make(map[string]*hostSlot)
+)
+
+// hostSlot is the slots for one host, and how many are using or waiting on them, so it can be forgotten when
+// nobody is.
+type hostSlot struct {
+	slots chan struct{}
+	users int
+}
+
+// SetPerHostConcurrency caps the number of chunks fetched at once from any one host, across every RangeTripper
+// in the process, in addition to each RangeTripper's own limit (see SetMax). It is meant for downloading from
+// many hosts at once, so a slow host can't hog every worker, while another is overwhelmed. A “n“ less than 1,
+// the default, means no cap. It is safe to call at any time, but chunks already fetching keep the slots they have.
+func SetPerHostConcurrency(n int) {
+	hostSlotsLock.Lock()
+	defer hostSlotsLock.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	hostLimit = n
+	// Start afresh, so the new limit applies, and the old slots are given back to nobody
+	hostSlots = make(map[string]*hostSlot)
+}
+
+// lockHost takes a slot for the host of “rawURL“, unless the context is done first, in which case its error is
+// returned. The returned func gives the slot back.
+func lockHost(ctx context.Context, rawURL string) (func(), error) {
+	hostSlotsLock.Lock()
+	if hostLimit < 1 {
+		hostSlotsLock.Unlock()
+		return func() {}, nil
+	}
+
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	slots := hostSlots
+	hs, ok := slots[host]
+	if !ok {
+		hs = &hostSlot{slots: make(chan struct{}, hostLimit)}
+		slots[host] = hs
+	}
+	hs.users++
+	hostSlotsLock.Unlock()
+
+	// done stops using the hostSlot, forgetting it if nobody else is
+	done := func() {
+		hostSlotsLock.Lock()
+		defer hostSlotsLock.Unlock()
+
+		hs.users--
+		if hs.users == 0 && slots[host] == hs {
+			delete(slots, host)
+		}
+	}
+
+	select {
+	case hs.slots <- struct{}{}:
+		return func() {
+			<-hs.slots
+			done()
+		}, nil
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
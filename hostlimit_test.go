@@ -0,0 +1,95 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_PerHostConcurrency(t *testing.T) {
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee`), 10)
+
+	Convey("When a per-host concurrency is set, RangeTrippers sharing a host never exceed it, and all complete", t, func() {
+		var current, most int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				n := atomic.AddInt32(&current, 1)
+				defer atomic.AddInt32(&current, -1)
+				for {
+					m := atomic.LoadInt32(&most)
+					if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		SetPerHostConcurrency(2)
+		defer SetPerHostConcurrency(0)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 3)
+		for i := 0; i < 3; i++ {
+			tfile, err := os.CreateTemp("/tmp", "phc")
+			So(err, ShouldBeNil)
+			defer os.Remove(tfile.Name())
+
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client))
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+				errs <- rerr
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+		So(atomic.LoadInt32(&most), ShouldBeBetweenOrEqual, 1, 2)
+	})
+
+	Convey("When a per-host concurrency is set, waiting for a slot stops when the context is done", t, func() {
+		SetPerHostConcurrency(1)
+		defer SetPerHostConcurrency(0)
+
+		release, err := lockHost(context.Background(), "http://example.com/a")
+		So(err, ShouldBeNil)
+
+		// Another host is unaffected
+		other, err := lockHost(context.Background(), "http://example.org/a")
+		So(err, ShouldBeNil)
+		other()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = lockHost(ctx, "http://example.com/b")
+		So(err, ShouldEqual, context.DeadlineExceeded)
+
+		release()
+		release, err = lockHost(context.Background(), "http://example.com/b")
+		So(err, ShouldBeNil)
+		release()
+
+		hostSlotsLock.Lock()
+		So(hostSlots, ShouldBeEmpty)
+		hostSlotsLock.Unlock()
+	})
+}
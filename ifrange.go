@@ -0,0 +1,41 @@
+package rangetripper
+
+import (
+	"net/http"
+)
+
+// ResourceChangedError is returned, wrapped, when a chunk is requested with the Request's “If-Range“ validator,
+// and the server sends the whole content instead of the range, meaning the content has changed since.
+const ResourceChangedError = rtError("content changed during the download")
+
+// SetRestartOnChange, if true, starts the download over, once, when the content changes during it, rather than
+// failing with a wrapped ResourceChangedError. Changes are only noticed if the Request has an “If-Range“
+// header, which is sent with every chunk, so long as it matches the probe's ETag or Last-Modified. What was
+// already downloaded is discarded, and the new content is fetched without “If-Range“.
+func (rt *RangeTripper) SetRestartOnChange(restart bool) {
+	rt.restartOnChange = restart
+}
+
+// ifRangeFor returns the “If-Range“ validator of the Request, if it matches the probe response, or the probe
+// has nothing to match it against, otherwise "", as the content has already changed and that's dealt with
+// elsewhere (see SetResumeFromFileSize).
+func ifRangeFor(r *http.Request, hres *http.Response) string {
+	validator := r.Header.Get("If-Range")
+	if validator == "" {
+		return ""
+	}
+
+	etag, lastModified := hres.Header.Get("ETag"), hres.Header.Get("Last-Modified")
+	if (etag == "" && lastModified == "") || validator == etag || validator == lastModified {
+		return validator
+	}
+	return ""
+}
+
+// withoutIfRange returns a copy of the Request without an “If-Range“ header, for starting over with whatever
+// the content is now.
+func withoutIfRange(r *http.Request) *http.Request {
+	fresh := r.Clone(r.Context())
+	fresh.Header.Del("If-Range")
+	return fresh
+}
@@ -0,0 +1,95 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_IfRange(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "ifr")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	var (
+		v1 = bytes.Repeat([]byte("1"), 400)
+		v2 = bytes.Repeat([]byte("2"), 400)
+	)
+
+	// A server whose content changes from v1 to v2 after the probe and the first chunk
+	newServer := func() *httptest.Server {
+		var gets atomic.Int32
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			etag, content := `"v1"`, v1
+			if req.Method == http.MethodGet && gets.Add(1) > 1 {
+				etag, content = `"v2"`, v2
+			}
+			rw.Header().Set("ETag", etag)
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+		}))
+	}
+
+	Convey("When the content changes during a download with If-Range, a ResourceChangedError is returned", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(1)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		req.Header.Set("If-Range", `"v1"`)
+		_, rerr := rt.RoundTrip(req)
+		So(errors.Is(rerr, ResourceChangedError), ShouldBeTrue)
+	})
+
+	Convey("When the content changes during a download with If-Range, and SetRestartOnChange is set, the new content is downloaded", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(1)
+		rt.SetRestartOnChange(true)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		req.Header.Set("If-Range", `"v1"`)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, v2)
+	})
+
+	Convey("The If-Range is only sent with chunks if it matches the probe", t, func() {
+		probe := &http.Response{Header: make(http.Header)}
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		So(ifRangeFor(req, probe), ShouldEqual, "")
+
+		req.Header.Set("If-Range", `"v1"`)
+		So(ifRangeFor(req, probe), ShouldEqual, `"v1"`)
+
+		probe.Header.Set("ETag", `"v1"`)
+		So(ifRangeFor(req, probe), ShouldEqual, `"v1"`)
+
+		probe.Header.Set("ETag", `"v2"`)
+		So(ifRangeFor(req, probe), ShouldEqual, "")
+
+		probe.Header.Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		req.Header.Set("If-Range", "Wed, 21 Oct 2015 07:28:00 GMT")
+		So(ifRangeFor(req, probe), ShouldEqual, "Wed, 21 Oct 2015 07:28:00 GMT")
+		So(withoutIfRange(req).Header.Get("If-Range"), ShouldEqual, "")
+		So(req.Header.Get("If-Range"), ShouldNotBeEmpty)
+	})
+}
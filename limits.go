@@ -0,0 +1,70 @@
+package rangetripper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ContentTooLargeError is returned, wrapped, when the content is bigger than SetMaxContentLength allows, be it
+// by its Content-Length, or by what was actually sent.
+type ContentTooLargeError struct {
+	// URL is where the content is
+	URL string
+	// Length is the length of the content, as far as is known
+	Length int64
+	// Max is the most that is allowed
+	Max int64
+}
+
+// Error returns the stringified version of ContentTooLargeError
+func (e ContentTooLargeError) Error() string {
+	return fmt.Sprintf("content of %s is %d bytes or more, over the limit of %d", e.URL, e.Length, e.Max)
+}
+
+// SetMaxContentLength sets the most bytes of content that will be downloaded, for use against untrusted URLs. If
+// the probe says the content is larger, RoundTrip fails with a wrapped ContentTooLargeError before anything is
+// fetched, and a download in one go that sends more than it said, or didn't say, is cut off with one. 0, the
+// default, means no limit.
+func (rt *RangeTripper) SetMaxContentLength(n int64) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.maxLength = n
+}
+
+// checkLength returns a ContentTooLargeError if “length“ is over the SetMaxContentLength limit.
+func (rt *RangeTripper) checkLength(url string, length int64) error {
+	if rt.maxLength > 0 && length > rt.maxLength {
+		return ContentTooLargeError{URL: url, Length: length, Max: rt.maxLength}
+	}
+	return nil
+}
+
+// limitedBody returns the Body of “res“, limited to one byte more than the SetMaxContentLength limit, if any,
+// so going over it can be detected with checkLength.
+func (rt *RangeTripper) limitedBody(res *http.Response) io.Reader {
+	if rt.maxLength > 0 {
+		return io.LimitReader(res.Body, rt.maxLength+1)
+	}
+	return res.Body
+}
+
+// SetMaxResponseHeaderBytes limits how many bytes of response headers the RetryClient will accept, so an origin
+// can't exhaust memory with enormous ones. If its Transport isn't an http.Transport, it is replaced with a copy
+// of http.DefaultTransport first. 0 restores the http.Transport default (currently 10MiB).
+func (w *RetryClient) SetMaxResponseHeaderBytes(n int64) {
+	t := w.transport()
+	t.MaxResponseHeaderBytes = n
+	w.client.Transport = t
+}
+
+// transport returns a copy of the RetryClient's Transport to change and set back, so one shared with anything
+// else isn't changed, or a copy of http.DefaultTransport if it isn't an http.Transport.
+func (w *RetryClient) transport() *http.Transport {
+	if t, ok := w.client.Transport.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
@@ -0,0 +1,121 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_MaxContentLength(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "mcl")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 100)
+
+	Convey("When the probe says the content is over the limit, nothing is fetched", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMaxContentLength(999)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		var ctle ContentTooLargeError
+		So(errors.As(rerr, &ctle), ShouldBeTrue)
+		So(ctle.Length, ShouldEqual, len(serverBytes))
+		So(ctle.Max, ShouldEqual, 999)
+		So(rt.RequestCount(), ShouldEqual, 1)
+	})
+
+	Convey("When the content is at the limit, it is downloaded", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMaxContentLength(int64(len(serverBytes)))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+	})
+
+	Convey("When content of unknown length goes over the limit, the download is cut off", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			// Flushed, so there's no Content-Length
+			rw.Write(serverBytes[:10])
+			rw.(http.Flusher).Flush()
+			rw.Write(serverBytes[10:])
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMaxContentLength(500)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		var ctle ContentTooLargeError
+		So(errors.As(rerr, &ctle), ShouldBeTrue)
+		So(ctle.Length, ShouldEqual, 501)
+	})
+
+	Convey("When a Content-Length is negative, it is invalid", t, func() {
+		res := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Request: httptest.NewRequest("GET", "http://example.com/", nil)}
+		res.Header.Set("Content-Length", "-5")
+		_, err := probeRangeSupport(res)
+		So(errors.Is(err, ContentLengthNumericError), ShouldBeTrue)
+
+		res.StatusCode = http.StatusPartialContent
+		res.Header.Set("Content-Range", "bytes 0-0/-5")
+		So(contentRangeTotal(res), ShouldEqual, -1)
+	})
+}
+
+func Test_MaxResponseHeaderBytes(t *testing.T) {
+	newGet := func(url string) *http.Request {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			panic(err)
+		}
+		return req
+	}
+
+	Convey("When a RetryClient limits the size of response headers, bigger ones are refused", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("X-Huge", strings.Repeat("x", 16<<10))
+			rw.Write([]byte("OK"))
+		}))
+		defer server.Close()
+
+		client := NewRetryClient(1, time.Millisecond, time.Second)
+		res, err := client.Do(newGet(server.URL))
+		So(err, ShouldBeNil)
+		res.Body.Close()
+
+		client.SetMaxResponseHeaderBytes(4 << 10)
+		_, err = client.Do(newGet(server.URL))
+		So(err, ShouldNotBeNil)
+
+		Convey("... and still are once a TLS config is set", func() {
+			client.SetTLSConfig(NewTLSConfig(tls.VersionTLS12))
+			_, err = client.Do(newGet(server.URL))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package rangetripper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MirrorAttempt is the outcome of trying to fetch a chunk from one URL
+type MirrorAttempt struct {
+	URL string
+	Err error
+}
+
+// MirrorChunkError is returned when a chunk could not be fetched from the original URL, nor any of the mirrors.
+// Attempts are in the order they were tried, beginning with the original URL.
+type MirrorChunkError struct {
+	Start    int64
+	End      int64
+	Attempts []MirrorAttempt
+}
+
+// Error returns the stringified version of MirrorChunkError, listing every attempt
+func (e *MirrorChunkError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "range %d-%d failed on all %d mirrors:", e.Start, e.End, len(e.Attempts))
+	for _, a := range e.Attempts {
+		fmt.Fprintf(&b, " [%s: %v]", a.URL, a.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors from each attempt
+func (e *MirrorChunkError) Unwrap() []error {
+	errs := make([]error, len(e.Attempts))
+	for i, a := range e.Attempts {
+		errs[i] = a.Err
+	}
+	return errs
+}
+
+// SetMirrors sets a list of URLs that serve the same content as the requested one. If fetching a chunk from
+// the requested URL fails, each mirror is tried in order. If all of them fail, the error is a *MirrorChunkError.
+// The HEAD probe is always made against the requested URL.
+func (rt *RangeTripper) SetMirrors(urls ...string) {
+	rt.mirrors = urls
+}
+
+// fetchRangeFromMirrors tries each mirror in turn for the specified range, after the original url failed
+// with “firstErr“.
+func (rt *RangeTripper) fetchRangeFromMirrors(ctx context.Context, start, end int64, url string, firstErr error) error {
+	mce := &MirrorChunkError{
+		Start:    start,
+		End:      end,
+		Attempts: []MirrorAttempt{{URL: url, Err: firstErr}},
+	}
+
+	for _, mirror := range rt.mirrors {
+		rt.DebugOut.Printf("Range %d-%d retrying from mirror %s\n", start, end, mirror)
+		err := rt.fetchRangeAttempts(ctx, start, end, mirror)
+		if err == nil {
+			return nil
+		}
+		mce.Attempts = append(mce.Attempts, MirrorAttempt{URL: mirror, Err: err})
+	}
+	return mce
+}
@@ -0,0 +1,88 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Mirrors(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+	// origin answers HEADs, but fails every GET
+	origin := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+			return
+		}
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer origin.Close()
+
+	bad := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		sbuff := bytes.NewReader(serverBytes)
+		http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+	}))
+	defer good.Close()
+
+	Convey("When the origin fails chunks, but a mirror works, RangeTripper downloads the content correctly", t, func() {
+		tfile, err := os.CreateTemp("/tmp", "rtmirror")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client)) // use a normal http.Client
+		rt.SetMirrors(bad.URL, good.URL)
+
+		req := httptest.NewRequest("GET", origin.URL, nil)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+
+	Convey("When the origin and all mirrors fail chunks, RangeTripper returns a MirrorChunkError listing every attempt", t, func() {
+		tfile, err := os.CreateTemp("/tmp", "rtmirror")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(1, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client)) // use a normal http.Client
+		rt.SetMirrors(bad.URL)
+
+		req := httptest.NewRequest("GET", origin.URL, nil)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldNotBeNil)
+
+		var mce *MirrorChunkError
+		So(errors.As(rerr, &mce), ShouldBeTrue)
+		So(mce.Start, ShouldEqual, 0)
+		So(mce.End, ShouldEqual, len(serverBytes))
+		So(mce.Attempts, ShouldHaveLength, 2)
+		So(mce.Attempts[0].URL, ShouldEqual, origin.URL)
+		So(mce.Attempts[0].Err.Error(), ShouldContainSubstring, "500")
+		So(mce.Attempts[1].URL, ShouldEqual, bad.URL)
+		So(mce.Attempts[1].Err.Error(), ShouldContainSubstring, "502")
+	})
+}
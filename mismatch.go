@@ -0,0 +1,72 @@
+package rangetripper
+
+import (
+	"errors"
+	"sort"
+)
+
+// SetRetryOnMismatch sets the number of times a ranged download is run again if it fails because a chunk didn't
+// match what was asked for, i.e. its Piece hash (a wrapped PieceHashMismatchError) or its length (a wrapped
+// RangeOverrunError), once any SetChunkRetries are used up. The chunks that completed are kept, so each attempt
+// only fetches what's still missing, from a fresh probe. The default is 0, so a mismatch fails the download.
+func (rt *RangeTripper) SetRetryOnMismatch(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.mismatchRetries = n
+}
+
+// isMismatch returns true if “err“ is a chunk not matching what was asked for, as SetRetryOnMismatch retries.
+func isMismatch(err error) bool {
+	return errors.Is(err, PieceHashMismatchError) || errors.Is(err, RangeOverrunError)
+}
+
+// retryIncomplete waits for any outstanding chunks, and clears the way for roundTrip to be run again, keeping
+// the chunks that completed in the output file.
+func (rt *RangeTripper) retryIncomplete() {
+	rt.wg.Wait()
+	rt.fetchError.Store(nil)
+	rt.reportedTotal = nil
+	rt.resetTotals()
+	rt.reusing = true
+}
+
+// withoutCompleted returns the chunks, offset by “offset“, that aren't already in the output file from an
+// earlier attempt (see SetRetryOnMismatch), and the number of bytes in those that are.
+func (rt *RangeTripper) withoutCompleted(chunks []Range, offset int64) ([]Range, int64) {
+	if !rt.reusing {
+		return chunks, 0
+	}
+
+	rt.completedLock.Lock()
+	done := append([]Range(nil), rt.completed...)
+	rt.completedLock.Unlock()
+	sort.Slice(done, func(i, j int) bool { return done[i].Start < done[j].Start })
+
+	// Merge them, so a chunk spanning adjacent completed ones is covered
+	var merged []Range
+	for _, d := range done {
+		if n := len(merged); n > 0 && d.Start <= merged[n-1].End {
+			if d.End > merged[n-1].End {
+				merged[n-1].End = d.End
+			}
+			continue
+		}
+		merged = append(merged, d)
+	}
+
+	var (
+		missing []Range
+		kept    int64
+	)
+	for _, c := range chunks {
+		i := sort.Search(len(merged), func(i int) bool { return merged[i].End >= c.End+offset })
+		if i < len(merged) && merged[i].Start <= c.Start+offset {
+			kept += c.Length()
+			continue
+		}
+		missing = append(missing, c)
+	}
+	return missing, kept
+}
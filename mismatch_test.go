@@ -0,0 +1,110 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_RetryOnMismatch(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "mismatch")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	var pieces []Piece
+	for _, c := range planChunks(int64(len(serverBytes)), 0, 100) {
+		sum := sha256.Sum256(serverBytes[c.Start:c.End])
+		pieces = append(pieces, Piece{Start: c.Start, End: c.End, SHA256: hex.EncodeToString(sum[:])})
+	}
+
+	// corrupting returns a server that flips a byte in the first response for the range starting at 100, and
+	// counts the requests for each range
+	corrupting := func() (*httptest.Server, func() map[string]int) {
+		var (
+			lock   sync.Mutex
+			served = make(map[string]int)
+		)
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				lock.Lock()
+				ranged := req.Header.Get("Range")
+				served[ranged]++
+				bad := ranged == "bytes=100-199" && served[ranged] == 1
+				lock.Unlock()
+
+				content := serverBytes
+				if bad {
+					content = bytes.Clone(serverBytes)
+					content[150] ^= 0xff
+				}
+				http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+			})), func() map[string]int {
+				lock.Lock()
+				defer lock.Unlock()
+				return served
+			}
+	}
+
+	Convey("When a chunk mismatches, and the download is retried, only the chunks that didn't complete are fetched again", t, func() {
+		server, served := corrupting()
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(pieces)
+		rt.SetChunkRetries(0)
+		rt.SetRetryOnMismatch(1)
+		rt.SetMax(1) // So nothing else is in flight, to be abandoned, when the chunk mismatches
+		So(rt.Config().MismatchRetries, ShouldEqual, 1)
+		progress := NewProgressAccumulator(rt.WithProgress())
+		var lastPct float64
+		rt.SetProgressInterval(time.Hour, func(pct float64, bps int64) { lastPct = pct })
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		// The chunk that mismatched is only counted once
+		progress.Wait()
+		So(progress.Received(), ShouldEqual, len(serverBytes))
+		So(lastPct, ShouldEqual, 100)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+
+		So(served()["bytes=100-199"], ShouldEqual, 2)
+		for _, c := range pieces[2:] {
+			So(served()[fmt.Sprintf("bytes=%d-%d", c.Start, c.End-1)], ShouldEqual, 1)
+		}
+		So(served()["bytes=0-99"], ShouldEqual, 1)
+	})
+
+	Convey("When a chunk mismatches, and the download isn't retried, it fails", t, func() {
+		server, _ := corrupting()
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(pieces)
+		rt.SetChunkRetries(0)
+		rt.SetRetryOnMismatch(-1)
+		So(rt.Config().MismatchRetries, ShouldEqual, 0)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, PieceHashMismatchError), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,83 @@
+package rangetripper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// newerWorkers is how many chunks DownloadIfNewer downloads at once
+const newerWorkers = 10
+
+// DownloadIfNewer downloads the content at “url“ to “path“, like a RangeTripper with SetPreserveModTime, but
+// only if there is no file at “path“, or the server says the content was modified since the file was, in
+// answer to a HEAD with If-Modified-Since. If the server says it wasn't, false is returned. The content is
+// downloaded to a temporary file alongside “path“, which is renamed over it once complete, so anything reading
+// “path“, or another DownloadIfNewer of it running at the same time, only ever sees a whole file. A new file
+// gets mode 0644, and a replaced one keeps its mode.
+func DownloadIfNewer(ctx context.Context, url, path string) (bool, error) {
+	var (
+		mtime time.Time
+		mode  os.FileMode = 0644
+	)
+	if fileStats, err := os.Stat(path); err == nil {
+		mtime = fileStats.ModTime()
+		mode = fileStats.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	if !mtime.IsZero() {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("If-Modified-Since", mtime.UTC().Format(http.TimeFormat))
+
+		res, err := defaultClient().Do(req)
+		if err != nil {
+			return false, err
+		}
+		res.Body.Close()
+		if res.StatusCode == http.StatusNotModified {
+			return false, nil
+		} else if res.StatusCode != http.StatusOK {
+			return false, fmt.Errorf("error during HEAD: %d / %s", res.StatusCode, res.Status)
+		} else if lm, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil && !lm.After(mtime.Truncate(time.Second)) {
+			// The server ignored If-Modified-Since, but told us enough to decide for ourselves
+			return false, nil
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name()) // harmless once renamed
+
+	rt, err := New(newerWorkers, tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	rt.SetPreserveModTime(true)
+	rt.SetFileMode(mode)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	if _, err = rt.RoundTrip(req); err != nil {
+		return false, err
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,114 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_DownloadIfNewer(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		content  = []byte(`OK I have something to say here weeeeee`)
+		modified = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		gets     int32
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		lock.Lock()
+		c, m := content, modified
+		lock.Unlock()
+		http.ServeContent(rw, req, "", m, bytes.NewReader(c))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "newer")
+
+	Convey("When there is no local file, DownloadIfNewer downloads it, with the remote modification time", t, func() {
+		updated, err := DownloadIfNewer(context.Background(), server.URL, path)
+		So(err, ShouldBeNil)
+		So(updated, ShouldBeTrue)
+
+		b, err := os.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, content)
+
+		fileStats, err := os.Stat(path)
+		So(err, ShouldBeNil)
+		So(fileStats.ModTime().Equal(modified), ShouldBeTrue)
+
+		Convey("... and when the remote hasn't changed, it doesn't download it again", func() {
+			before := atomic.LoadInt32(&gets)
+			updated, err := DownloadIfNewer(context.Background(), server.URL, path)
+			So(err, ShouldBeNil)
+			So(updated, ShouldBeFalse)
+			So(atomic.LoadInt32(&gets), ShouldEqual, before)
+		})
+	})
+
+	Convey("When the remote is newer, DownloadIfNewer replaces the local file, even when run concurrently", t, func() {
+		newContent := bytes.Repeat([]byte(`All new, all different `), 20)
+		lock.Lock()
+		content = newContent
+		modified = modified.Add(time.Hour)
+		lock.Unlock()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 3)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := DownloadIfNewer(context.Background(), server.URL, path)
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+
+		b, err := os.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, newContent)
+
+		// No temporary files left behind
+		entries, err := os.ReadDir(filepath.Dir(path))
+		So(err, ShouldBeNil)
+		So(entries, ShouldHaveLength, 1)
+	})
+
+	Convey("When the server ignores If-Modified-Since, DownloadIfNewer decides by Last-Modified", t, func() {
+		ignorant := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				atomic.AddInt32(&gets, 1)
+			}
+			req.Header.Del("If-Modified-Since")
+			lock.Lock()
+			c, m := content, modified
+			lock.Unlock()
+			http.ServeContent(rw, req, "", m, bytes.NewReader(c))
+		}))
+		defer ignorant.Close()
+
+		before := atomic.LoadInt32(&gets)
+		updated, err := DownloadIfNewer(context.Background(), ignorant.URL, path)
+		So(err, ShouldBeNil)
+		So(updated, ShouldBeFalse)
+		So(atomic.LoadInt32(&gets), ShouldEqual, before)
+	})
+}
@@ -0,0 +1,145 @@
+package rangetripper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PartWriter is a destination that takes content a part at a time, such as an object storage multipart upload,
+// instead of a local file. Parts may be written concurrently, and in any order.
+type PartWriter interface {
+	// WritePart writes part “n“, which is the half-open byte range “start“ to “end“ of the content, from “r“.
+	// Parts are numbered from 1, in order of their offset. If the size isn't known, “end“ is -1. WritePart
+	// must read “r“ to the end.
+	WritePart(n int, start, end int64, r io.Reader) error
+}
+
+// WriteParts downloads the url like RoundTrip, but hands each chunk to the PartWriter as a numbered part instead
+// of writing it to the output file, so nothing touches local disk. Chunks are planned as usual, so use SetChunkSize
+// to satisfy any minimum part size the destination has. If the server doesn't support ranges, or doesn't say how
+// big the content is, the whole of it is written as part 1. The number of parts written is returned. WriteParts
+// counts as the one request allowed for this RangeTripper.
+func (rt *RangeTripper) WriteParts(ctx context.Context, url string, pw PartWriter) (parts int, err error) {
+	if l := rt.withLoggers(ctx); l != rt {
+		return l.WriteParts(ctx, url, pw)
+	}
+
+	rt.checkLock.Lock()
+	defer rt.checkLock.Unlock()
+
+	if rt.used {
+		return 0, SingleRequestExhaustedError
+	}
+	rt.used = true
+	start := time.Now()
+	rt.result.URL, rt.result.FinalURL = url, url
+	defer func() {
+		rt.result.Duration = time.Since(start)
+		rt.settle(err)
+	}()
+
+	hres, err := rt.head(rt.opContext(), url)
+	if err != nil {
+		return 0, err
+	}
+	hres.Body.Close()
+	if hres.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error during HEAD: %d / %s", hres.StatusCode, hres.Status)
+	}
+	rs, err := probeRangeSupport(hres)
+	if err != nil {
+		return 0, err
+	}
+
+	if !rs.ok || rs.total < 1 {
+		// No ranges, or no idea how big it is, so it's all one part
+		rt.DebugOut.Printf("Range Download unsupported, writing %s as one part\n", url)
+		return 1, rt.writeWholePart(ctx, url, pw)
+	}
+
+	chunks := planChunks(rs.total, rt.workers, rt.chunkSizeFor(rs.total))
+	rt.result.Ranged = true
+	rt.result.Chunks = len(chunks)
+	rt.DebugOut.Printf("Ranges supported! Writing Content Length: %d, Parts: %d\n", rs.total, len(chunks))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i, c := range chunks {
+		if err := rt.lockSem(ctx); err != nil {
+			errOnce.Do(func() { firstErr = err })
+			break
+		}
+		wg.Add(1)
+		go func(n int, c Range) {
+			defer wg.Done()
+			defer rt.sem.Unlock()
+
+			if err := rt.writePart(ctx, url, n, c, pw); err != nil {
+				errOnce.Do(func() { firstErr = fmt.Errorf("part %d (%d-%d): %w", n, c.Start, c.End, err) })
+				cancel()
+			}
+		}(i+1, c)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return len(chunks), nil
+}
+
+// writePart fetches one chunk, and hands its Body to the PartWriter
+func (rt *RangeTripper) writePart(ctx context.Context, url string, n int, c Range, pw PartWriter) error {
+	release, err := lockHost(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	res, err := rt.getRange(ctx, c.Start, c.End, url)
+	if err != nil {
+		return err
+	}
+	defer drainAndClose(res.Body)
+
+	body := &countingReader{r: io.LimitReader(res.Body, c.Length()), total: &rt.received}
+	if err = pw.WritePart(n, c.Start, c.End, body); err != nil {
+		body.uncount()
+		return err
+	} else if overran(res.Body) {
+		body.uncount()
+		return RangeOverrunError
+	} else if body.n != c.Length() {
+		body.uncount()
+		return ContentLengthMismatchError{Expected: c.Length(), Actual: body.n}
+	}
+	return nil
+}
+
+// writeWholePart GETs the url, and hands the Body to the PartWriter as part 1
+func (rt *RangeTripper) writeWholePart(ctx context.Context, url string, pw PartWriter) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := rt.do(rt.client, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("non 2XX HTTP status received: %s", res.Status)
+	}
+	return pw.WritePart(1, 0, res.ContentLength, res.Body)
+}
@@ -0,0 +1,135 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryParts is a PartWriter that keeps the parts in memory
+type memoryParts struct {
+	lock  sync.Mutex
+	parts map[int][]byte
+	spans map[int]Range
+}
+
+func (m *memoryParts) WritePart(n int, start, end int64, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.parts[n] = b
+	m.spans[n] = Range{Start: start, End: end}
+	return nil
+}
+
+// assemble returns the parts, in order, concatenated
+func (m *memoryParts) assemble() []byte {
+	var ns []int
+	for n := range m.parts {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+
+	var all []byte
+	for _, n := range ns {
+		all = append(all, m.parts[n]...)
+	}
+	return all
+}
+
+func Test_WriteParts(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+	tfile, err := os.CreateTemp("/tmp", "rtparts")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+	tfile.Close()
+	os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, WriteParts writes each chunk as a numbered part, and no file", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(10)
+
+		mp := &memoryParts{parts: make(map[int][]byte), spans: make(map[int]Range)}
+		n, perr := rt.WriteParts(context.Background(), server.URL, mp)
+		So(perr, ShouldBeNil)
+		So(n, ShouldEqual, 8)
+		So(len(mp.parts), ShouldEqual, 8)
+		So(mp.spans[1], ShouldResemble, Range{Start: 0, End: 10})
+		So(mp.spans[8], ShouldResemble, Range{Start: 70, End: 79})
+		So(string(mp.assemble()), ShouldEqual, string(serverBytes))
+
+		_, serr := os.Stat(tfile.Name())
+		So(os.IsNotExist(serr), ShouldBeTrue)
+
+		Convey("... and a second request fails appropriately", func() {
+			_, perr := rt.WriteParts(context.Background(), server.URL, mp)
+			So(perr, ShouldEqual, SingleRequestExhaustedError)
+		})
+	})
+
+	Convey("When a server is started that doesn't support ranges, WriteParts writes the content as one part", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes) // Simple write
+		}))
+		defer server.Close()
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+
+		mp := &memoryParts{parts: make(map[int][]byte), spans: make(map[int]Range)}
+		n, perr := rt.WriteParts(context.Background(), server.URL, mp)
+		So(perr, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(string(mp.parts[1]), ShouldEqual, string(serverBytes))
+	})
+
+	Convey("When a server sends short ranges, WriteParts fails", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+				return
+			}
+			// Just the first byte of whatever was asked for
+			var first int
+			fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-", &first)
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/79", first, first))
+			rw.WriteHeader(http.StatusPartialContent)
+			rw.Write(serverBytes[first : first+1])
+		}))
+		defer server.Close()
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(10)
+
+		mp := &memoryParts{parts: make(map[int][]byte), spans: make(map[int]Range)}
+		_, perr := rt.WriteParts(context.Background(), server.URL, mp)
+		So(perr, ShouldNotBeNil)
+		So(errors.Is(perr, ContentLengthMismatchError{}), ShouldBeTrue)
+	})
+}
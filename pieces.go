@@ -0,0 +1,68 @@
+package rangetripper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// PieceHashMismatchError is returned, wrapped, when a chunk downloaded for a Piece doesn't match its hash
+const PieceHashMismatchError = rtError("downloaded piece does not match its hash")
+
+// Piece is a range of the content, and the hex-encoded SHA-256 hash of its bytes, as listed in a manifest
+type Piece struct {
+	Start int64
+	End   int64
+	// SHA256 is the hex-encoded SHA-256 hash of the bytes from Start to End
+	SHA256 string
+}
+
+// SetPieceManifest sets the Pieces the content is made of, which are then the chunks downloaded, each checked
+// against its hash as soon as it arrives. A chunk that doesn't match is retried, up to the SetChunkRetries limit,
+// and then fails the download with a wrapped PieceHashMismatchError, so corruption is pinned to a range rather
+// than found after the fact. The Pieces must cover the content exactly, and the server must support ranges, as
+// with SetRequireRanges. SetChunkSize, SetMaxChunks, and SetScheduler don't apply, and a download that would
+// resume (see SetResumeFromFileSize) starts over, as Pieces are only ever fetched whole.
+func (rt *RangeTripper) SetPieceManifest(pieces []Piece) {
+	rt.pieces = nil
+	rt.pieceHashes = nil
+	rt.pieceErr = nil
+	if len(pieces) == 0 {
+		return
+	}
+
+	rt.pieceHashes = make(map[Range][]byte, len(pieces))
+	for _, p := range pieces {
+		r := Range{Start: p.Start, End: p.End}
+		sum, err := hex.DecodeString(p.SHA256)
+		if err == nil && len(sum) != sha256.Size {
+			err = fmt.Errorf("%d bytes, not %d", len(sum), sha256.Size)
+		}
+		if err != nil && rt.pieceErr == nil {
+			rt.pieceErr = fmt.Errorf("piece %d-%d has an invalid SHA256 '%s': %w", p.Start, p.End, p.SHA256, err)
+		}
+		rt.pieces = append(rt.pieces, r)
+		rt.pieceHashes[r] = sum
+	}
+	sort.Slice(rt.pieces, func(i, j int) bool { return rt.pieces[i].Start < rt.pieces[j].Start })
+}
+
+// pieceHasher returns a hash.Hash for the chunk from “start“ to “end“, and a func to check its sum against
+// the Piece's hash, or nils if the chunk isn't a Piece.
+func (rt *RangeTripper) pieceHasher(start, end int64) (hash.Hash, func() error) {
+	want, ok := rt.pieceHashes[Range{Start: start, End: end}]
+	if !ok {
+		return nil, nil
+	}
+
+	h := sha256.New()
+	return h, func() error {
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			return fmt.Errorf("piece %d-%d has SHA256 %x, not %x: %w", start, end, got, want, PieceHashMismatchError)
+		}
+		return nil
+	}
+}
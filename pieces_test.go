@@ -0,0 +1,128 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_PieceManifest(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pieces")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// manifest returns Pieces of “size“ bytes covering serverBytes
+	manifest := func(size int64) []Piece {
+		var pieces []Piece
+		for _, c := range planChunks(int64(len(serverBytes)), 0, size) {
+			sum := sha256.Sum256(serverBytes[c.Start:c.End])
+			pieces = append(pieces, Piece{Start: c.Start, End: c.End, SHA256: hex.EncodeToString(sum[:])})
+		}
+		return pieces
+	}
+
+	// corrupting returns a server that flips a byte in the first “bad“ responses for the range starting at 100
+	corrupting := func(bad int32) (*httptest.Server, *atomic.Int32) {
+		var served atomic.Int32
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			content := serverBytes
+			if req.Header.Get("Range") == "bytes=100-199" && served.Add(1) <= bad {
+				content = bytes.Clone(serverBytes)
+				content[150] ^= 0xff
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+		})), &served
+	}
+
+	Convey("When a piece manifest is set, the pieces are the chunks, and a good download is verified", t, func() {
+		server, _ := corrupting(0)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(manifest(100))
+		So(rt.ExpectedRequestCount(int64(len(serverBytes))), ShouldEqual, 5)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When a piece arrives corrupted once, it is fetched again, buffered or not", t, func() {
+		for _, bufSize := range []int{0, 16} {
+			server, served := corrupting(1)
+
+			rt, err := New(2, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetPieceManifest(manifest(100))
+			rt.SetChunkRetries(1)
+			rt.SetWriteBufferSize(bufSize)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+			So(served.Load(), ShouldEqual, 2)
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+			server.Close()
+		}
+	})
+
+	Convey("When a piece keeps arriving corrupted, the download fails with PieceHashMismatchError", t, func() {
+		server, served := corrupting(100)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(manifest(100))
+		rt.SetChunkRetries(2)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, PieceHashMismatchError), ShouldBeTrue)
+		So(rerr.Error(), ShouldContainSubstring, "100-200")
+		So(served.Load(), ShouldEqual, 3)
+	})
+
+	Convey("When a piece manifest has a bad hash, or doesn't cover the content, the download fails before fetching anything", t, func() {
+		server, _ := corrupting(0)
+		defer server.Close()
+
+		pieces := manifest(100)
+		pieces[2].SHA256 = "nothex"
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(pieces)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(rerr.Error(), ShouldContainSubstring, "invalid SHA256")
+		So(rt.RequestCount(), ShouldEqual, 1)
+
+		rt, err = New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPieceManifest(manifest(100)[1:])
+
+		_, rerr = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(rerr.Error(), ShouldContainSubstring, "gap")
+		So(rt.RequestCount(), ShouldEqual, 1)
+	})
+}
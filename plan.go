@@ -0,0 +1,284 @@
+package rangetripper
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// DefaultMaxChunks is the most chunks a download will be divided into by SetChunkSize, unless
+// SetMaxChunks is used.
+const DefaultMaxChunks = 10000
+
+// Range is a half-open byte range: Start is the first byte, End is one past the last byte.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// Length returns the number of bytes in the Range
+func (r Range) Length() int64 {
+	return r.End - r.Start
+}
+
+// planChunks divides “total“ bytes into the Ranges that workers will fetch. If “chunkSize“ is non-zero it
+// is used as the size of each Range, otherwise “total“ is divided evenly by “workers“. Either way, if the
+// division isn't even, a final gap Range covers the remainder. No Range ever ends past “total“.
+func planChunks(total int64, workers int, chunkSize int64) []Range {
+	if total < 1 {
+		return nil
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	if chunkSize == 0 {
+		chunkSize = total / int64(workers)
+	} else {
+		workers = int(total / chunkSize)
+	}
+
+	if chunkSize < 1 {
+		// more workers than bytes, so one worker gets the lot
+		return []Range{{Start: 0, End: total}}
+	}
+
+	var (
+		start  int64
+		end    int64
+		ranges = make([]Range, 0, workers+1)
+	)
+	for i := 0; i < workers && start < total; i++ {
+		if end = start + chunkSize; end > total {
+			// No worker may ask for more than there is, in which case there's no gap either
+			end = total
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+		start = end
+	}
+	if end < total {
+		// gap
+		ranges = append(ranges, Range{Start: end, End: total})
+	}
+	return ranges
+}
+
+// SetScheduler sets a function that divides the “total“ bytes of a ranged download by RoundTrip into the Ranges
+// that up to “workers“ workers will fetch, in place of the default of equal, contiguous Ranges in order, e.g.
+// to fetch the tail first, or to interleave. The Ranges are fetched in the order returned, and must cover
+// “total“ exactly, without overlapping, or the download fails. SetChunkSize and SetMaxChunks don't apply, but
+// the scheduler is free to do what it likes with chunk sizes. Stream and WriteParts, which need the content in
+// order, aren't affected. A nil scheduler restores the default.
+func (rt *RangeTripper) SetScheduler(scheduler func(total int64, workers int) []Range) {
+	rt.scheduler = scheduler
+}
+
+// SetChunkPlanner sets a function that is given the probe response of a ranged download by RoundTrip, and
+// decides how many workers to divide it between, and the chunk size, as “fileChunks“ and SetChunkSize would, e.g.
+// from a header the origin hints with, or by Content-Type. A “workers“ less than 1 leaves the number as it was,
+// and a “chunkSize“ of 0 divides the content by “workers“ instead. SetMaxChunks and SetWorkerBounds still
+// apply, and SetMax still limits how many run at once. A nil planner, the default, leaves them as they were set.
+func (rt *RangeTripper) SetChunkPlanner(planner func(probe *http.Response) (workers int, chunkSize int64)) {
+	rt.chunkPlanner = planner
+}
+
+// planFromProbe returns the workers and chunk size to plan the download with: those from the SetChunkPlanner
+// function, if any, given the probe, otherwise those set. The settings themselves are left alone, so a download
+// that is run again starts from them.
+func (rt *RangeTripper) planFromProbe(dlid string, hres *http.Response) (int, int64) {
+	if rt.chunkPlanner == nil {
+		return rt.workers, rt.chunkSize
+	}
+
+	workers, chunkSize := rt.chunkPlanner(hres)
+	if workers < 1 {
+		workers = rt.workers
+	}
+	if chunkSize < 0 {
+		chunkSize = 0
+	}
+	rt.DebugOut.Printf("[%s] Chunk planner says %d workers, chunk size %d\n", dlid, workers, chunkSize)
+	return workers, chunkSize
+}
+
+// customPlan returns true if the chunks are planned by something other than planChunks
+func (rt *RangeTripper) customPlan() bool {
+	return rt.pieceHashes != nil || rt.scheduler != nil
+}
+
+// planFor returns the Ranges to fetch “total“ bytes in, from the SetPieceManifest Pieces or the SetScheduler
+// function, if any, after checking them, or from planChunks, with “workers“ and the “chunkSize“ as chunkSizeFor
+// would adjust it.
+func (rt *RangeTripper) planFor(total int64, workers int, chunkSize int64) ([]Range, error) {
+	var chunks []Range
+	switch {
+	case rt.pieceHashes != nil:
+		if rt.pieceErr != nil {
+			return nil, rt.pieceErr
+		}
+		chunks = append(chunks, rt.pieces...)
+	case rt.scheduler != nil:
+		chunks = rt.scheduler(total, workers)
+	default:
+		return planChunks(total, workers, rt.sizeChunks(total, chunkSize)), nil
+	}
+
+	sorted := append([]Range(nil), chunks...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var covered int64
+	for _, c := range sorted {
+		if c.Length() < 1 || c.Start != covered {
+			return nil, fmt.Errorf("planned range %d-%d leaves a gap or overlaps at %d of %d", c.Start, c.End, covered, total)
+		}
+		covered = c.End
+	}
+	if covered != total {
+		return nil, fmt.Errorf("planned ranges cover %d of %d bytes", covered, total)
+	}
+	return chunks, nil
+}
+
+// subtractRange returns “ranges“, in order, less any parts of them within “cut“
+func subtractRange(ranges []Range, cut Range) []Range {
+	out := make([]Range, 0, len(ranges)+1)
+	for _, r := range ranges {
+		if r.End <= cut.Start || r.Start >= cut.End {
+			out = append(out, r)
+			continue
+		}
+		if r.Start < cut.Start {
+			out = append(out, Range{Start: r.Start, End: cut.Start})
+		}
+		if r.End > cut.End {
+			out = append(out, Range{Start: cut.End, End: r.End})
+		}
+	}
+	return out
+}
+
+// chunkSizeFor returns the chunk size to plan “total“ bytes with: 0 if the division is by workers, otherwise
+// the SetChunkSize value, raised if needed so there are no more than maxChunks chunks, and then adjusted to
+// keep the number of workers within SetWorkerBounds.
+func (rt *RangeTripper) chunkSizeFor(total int64) int64 {
+	return rt.sizeChunks(total, rt.chunkSize)
+}
+
+// sizeChunks returns “chunkSize“ adjusted as chunkSizeFor does the SetChunkSize value.
+func (rt *RangeTripper) sizeChunks(total, chunkSize int64) int64 {
+	if chunkSize == 0 {
+		return 0
+	}
+
+	size := chunkSize
+	for _, max := range []int64{int64(rt.maxChunks), int64(rt.workersMax)} {
+		if max > 0 && total/size > max {
+			size = (total + max - 1) / max
+		}
+	}
+	if min := int64(rt.workersMin); min > 0 && total/size < min {
+		size = total / min
+		if size < 1 {
+			// Fewer bytes than workers, so one each
+			size = 1
+		}
+	}
+	return size
+}
+
+// PlanEstimate is what a download of a given size would look like, given the current settings
+type PlanEstimate struct {
+	// Workers is the number of chunks that would be fetched, including any gap chunk
+	Workers int
+	// ChunkSize is the size of each chunk, save for any gap chunk
+	ChunkSize int64
+	// Requests is the number of HTTP requests that would be made, including the HEAD, but not any retries
+	Requests int
+	// PeakMemory is the most chunk data that would be held in memory at once
+	PeakMemory int64
+}
+
+// EstimatePlan returns a PlanEstimate for downloading “contentLength“ bytes with the current settings, assuming
+// the server supports ranges. Nothing is downloaded.
+func (rt *RangeTripper) EstimatePlan(contentLength int64) PlanEstimate {
+	chunks, _ := rt.planFor(contentLength, rt.workers, rt.chunkSize)
+
+	pe := PlanEstimate{
+		Workers:  len(chunks),
+		Requests: len(chunks) + 1,
+	}
+	if len(chunks) > 0 {
+		pe.ChunkSize = chunks[0].Length()
+	}
+
+	// The worst case is the largest chunks all in flight at once.
+	lengths := make([]int64, len(chunks))
+	for i, c := range chunks {
+		lengths[i] = c.Length()
+	}
+	sort.Slice(lengths, func(i, j int) bool { return lengths[i] > lengths[j] })
+
+	for i := 0; i < len(lengths) && i < rt.maxWorkers; i++ {
+		size := lengths[i]
+		if rt.writeBufferSize > 0 && int64(rt.writeBufferSize) < size {
+			size = int64(rt.writeBufferSize)
+		}
+		pe.PeakMemory += size
+	}
+	if rt.inFlight != nil && rt.inFlight.max < pe.PeakMemory {
+		pe.PeakMemory = rt.inFlight.max
+	}
+
+	return pe
+}
+
+// ExpectedRequestCount returns the number of HTTP requests a download of “contentLength“ bytes would make with
+// the current settings, assuming the server supports ranges and nothing needs retrying: the HEAD, and one GET
+// per chunk. Compare with RequestCount after the fact.
+func (rt *RangeTripper) ExpectedRequestCount(contentLength int64) int {
+	return rt.EstimatePlan(contentLength).Requests
+}
+
+// PlanEvent describes how a download has been divided into chunks
+type PlanEvent struct {
+	// ContentLength is the size of the content
+	ContentLength int64
+	// Offset is where the download starts, if resuming
+	Offset int64
+	// Ranges are the chunks that will be fetched, at their offsets in the output file
+	Ranges []Range
+}
+
+// WithPlan returns a read-only chan that will provide a PlanEvent once the download has been planned, before
+// any chunks are fetched, and another if the plan changes because the server reports a different size than
+// the probe did, or the download is planned again because it restarted (see SetShrinkRestarts). Nothing is sent
+// if the content isn't downloaded in chunks. A PlanEvent that doesn't fit in the chan's buffer is dropped,
+// rather than holding up the download, and the chan is closed when RoundTrip returns, so it can be ranged over.
+func (rt *RangeTripper) WithPlan() <-chan PlanEvent {
+	if rt.plans == nil {
+		rt.plans = make(chan PlanEvent, 2)
+	}
+	return rt.plans
+}
+
+// publishPlan sends a PlanEvent to any WithPlan chan, shifting the “chunks“ by “offset“, unless its buffer is full.
+func (rt *RangeTripper) publishPlan(contentLength, offset int64, chunks []Range) {
+	if rt.plans == nil {
+		return
+	}
+
+	pe := PlanEvent{
+		ContentLength: contentLength,
+		Offset:        offset,
+		Ranges:        make([]Range, len(chunks)),
+	}
+	for i, c := range chunks {
+		pe.Ranges[i] = Range{Start: c.Start + offset, End: c.End + offset}
+	}
+	select {
+	case rt.plans <- pe:
+	default:
+		rt.DebugOut.Printf("WithPlan chan is full, dropping the plan of %d chunks\n", len(pe.Ranges))
+	}
+}
@@ -0,0 +1,461 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_PlanChunks(t *testing.T) {
+
+	Convey("When the content length divides evenly by the number of workers, there is no gap chunk", t, func() {
+		chunks := planChunks(100, 10, 0)
+		So(chunks, ShouldHaveLength, 10)
+		So(chunks[0], ShouldResemble, Range{Start: 0, End: 10})
+		So(chunks[9], ShouldResemble, Range{Start: 90, End: 100})
+	})
+
+	Convey("When the content length is one more than divides evenly, there is a one-byte gap chunk", t, func() {
+		chunks := planChunks(101, 10, 0)
+		So(chunks, ShouldHaveLength, 11)
+		So(chunks[9], ShouldResemble, Range{Start: 90, End: 100})
+		So(chunks[10], ShouldResemble, Range{Start: 100, End: 101})
+		So(chunks[10].Length(), ShouldEqual, 1)
+	})
+
+	Convey("When the content length leaves a large remainder, the gap chunk covers all of it", t, func() {
+		chunks := planChunks(109, 10, 0)
+		So(chunks, ShouldHaveLength, 11)
+		So(chunks[10], ShouldResemble, Range{Start: 100, End: 109})
+	})
+
+	Convey("When a chunkSize is set, it determines the number of chunks", t, func() {
+		chunks := planChunks(100, 3, 30)
+		So(chunks, ShouldHaveLength, 4)
+		So(chunks[0], ShouldResemble, Range{Start: 0, End: 30})
+		So(chunks[3], ShouldResemble, Range{Start: 90, End: 100})
+
+		chunks = planChunks(90, 3, 30)
+		So(chunks, ShouldHaveLength, 3)
+	})
+
+	Convey("When there are more workers than bytes, a single chunk covers everything", t, func() {
+		chunks := planChunks(5, 10, 0)
+		So(chunks, ShouldResemble, []Range{{Start: 0, End: 5}})
+	})
+
+	Convey("Every plan covers the content exactly once, in order", t, func() {
+		for total := int64(1); total < 200; total += 7 {
+			for workers := 1; workers < 12; workers++ {
+				var next int64
+				for _, c := range planChunks(total, workers, 0) {
+					So(c.Start, ShouldEqual, next)
+					So(c.End, ShouldBeGreaterThan, c.Start)
+					next = c.End
+				}
+				So(next, ShouldEqual, total)
+			}
+		}
+	})
+
+	Convey("When a chunkSize doesn't divide the content length, or exceeds it, no chunk ends past the content", t, func() {
+		So(planChunks(100, 0, 33), ShouldResemble, []Range{{Start: 0, End: 33}, {Start: 33, End: 66}, {Start: 66, End: 99}, {Start: 99, End: 100}})
+		So(planChunks(100, 0, 150), ShouldResemble, []Range{{Start: 0, End: 100}})
+
+		for total := int64(1); total < 200; total += 7 {
+			for chunkSize := int64(1); chunkSize < 250; chunkSize += 11 {
+				var next int64
+				for _, c := range planChunks(total, 4, chunkSize) {
+					So(c.Start, ShouldEqual, next)
+					So(c.End, ShouldBeGreaterThan, c.Start)
+					So(c.End, ShouldBeLessThanOrEqualTo, total)
+					next = c.End
+				}
+				So(next, ShouldEqual, total)
+			}
+		}
+	})
+}
+
+func Test_EstimatePlan(t *testing.T) {
+
+	Convey("When estimating a plan, the estimate reflects the settings", t, func() {
+		rt := &RangeTripper{download: newDownload(11), workers: 10, maxWorkers: 11}
+
+		pe := rt.EstimatePlan(1000)
+		So(pe.Workers, ShouldEqual, 10)
+		So(pe.ChunkSize, ShouldEqual, 100)
+		So(pe.Requests, ShouldEqual, 11)
+		So(pe.PeakMemory, ShouldEqual, 1000)
+
+		Convey("... including a gap worker", func() {
+			pe := rt.EstimatePlan(1005)
+			So(pe.Workers, ShouldEqual, 11)
+			So(pe.Requests, ShouldEqual, 12)
+			So(pe.PeakMemory, ShouldEqual, 1005)
+		})
+
+		Convey("... and limited concurrency", func() {
+			rt.SetMax(2)
+			pe := rt.EstimatePlan(1000)
+			So(pe.Workers, ShouldEqual, 10)
+			So(pe.PeakMemory, ShouldEqual, 200)
+		})
+
+		Convey("... and a chunk size", func() {
+			rt.SetChunkSize(300)
+			pe := rt.EstimatePlan(1000)
+			So(pe.Workers, ShouldEqual, 4)
+			So(pe.ChunkSize, ShouldEqual, 300)
+			So(pe.PeakMemory, ShouldEqual, 1000)
+		})
+
+		Convey("... and a write buffer", func() {
+			rt.SetWriteBufferSize(10)
+			pe := rt.EstimatePlan(1000)
+			So(pe.PeakMemory, ShouldEqual, 100)
+		})
+
+		Convey("... and an in-flight cap", func() {
+			rt.SetMaxInFlightBytes(250)
+			pe := rt.EstimatePlan(1000)
+			So(pe.PeakMemory, ShouldEqual, 250)
+		})
+	})
+}
+
+func Test_MaxChunks(t *testing.T) {
+
+	Convey("When a tiny chunk size would produce too many chunks, the chunk size is raised", t, func() {
+		rt := &RangeTripper{download: newDownload(11), workers: 10, maxWorkers: 11, maxChunks: DefaultMaxChunks}
+		rt.SetChunkSize(1)
+
+		pe := rt.EstimatePlan(1 << 30)
+		So(pe.Workers, ShouldBeLessThanOrEqualTo, DefaultMaxChunks)
+		So(pe.ChunkSize, ShouldEqual, (1<<30+DefaultMaxChunks-1)/DefaultMaxChunks)
+
+		Convey("... to respect a configured ceiling, including any gap chunk", func() {
+			rt.SetMaxChunks(10)
+			pe := rt.EstimatePlan(159)
+			So(pe.Workers, ShouldEqual, 10)
+			So(pe.ChunkSize, ShouldEqual, 16)
+		})
+
+		Convey("... unless the ceiling is removed", func() {
+			rt.SetMaxChunks(0)
+			pe := rt.EstimatePlan(159)
+			So(pe.Workers, ShouldEqual, 159)
+		})
+	})
+}
+
+func Test_WorkerBounds(t *testing.T) {
+
+	Convey("When worker bounds are set, the number of workers a chunk size gives is kept within them", t, func() {
+		rt := &RangeTripper{download: newDownload(11), workers: 10, maxWorkers: 11, maxChunks: DefaultMaxChunks}
+		rt.SetChunkSize(100)
+		rt.SetWorkerBounds(4, 8)
+
+		Convey("... lowering the chunk size for small content", func() {
+			pe := rt.EstimatePlan(150)
+			So(pe.Workers, ShouldBeGreaterThanOrEqualTo, 4)
+			So(pe.ChunkSize, ShouldEqual, 37)
+		})
+
+		Convey("... raising the chunk size for large content", func() {
+			pe := rt.EstimatePlan(10000)
+			So(pe.Workers, ShouldEqual, 8)
+			So(pe.ChunkSize, ShouldEqual, 1250)
+
+			pe = rt.EstimatePlan(10001)
+			So(pe.Workers, ShouldBeLessThanOrEqualTo, 8)
+		})
+
+		Convey("... leaving content that fits alone", func() {
+			pe := rt.EstimatePlan(600)
+			So(pe.Workers, ShouldEqual, 6)
+			So(pe.ChunkSize, ShouldEqual, 100)
+		})
+
+		Convey("... down to a byte each, for content smaller than the floor", func() {
+			pe := rt.EstimatePlan(3)
+			So(pe.Workers, ShouldEqual, 3)
+			So(pe.ChunkSize, ShouldEqual, 1)
+		})
+	})
+
+	Convey("When worker bounds are out of order or negative, they are fixed up", t, func() {
+		rt := &RangeTripper{download: newDownload(1)}
+		rt.SetWorkerBounds(5, 2)
+		So(rt.workersMin, ShouldEqual, 5)
+		So(rt.workersMax, ShouldEqual, 5)
+
+		rt.SetWorkerBounds(-1, -1)
+		So(rt.workersMin, ShouldEqual, 0)
+		So(rt.workersMax, ShouldEqual, 0)
+	})
+}
+
+func Test_ChunkPlanner(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "cp")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 100)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("X-Parallelism", "8")
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+	}))
+	defer server.Close()
+
+	// download fetches the content with “planner“, returning how many chunks it was fetched in
+	download := func(planner func(*http.Response) (int, int64)) (int, error) {
+		rt, err := New(4, tfile.Name())
+		if err != nil {
+			return 0, err
+		}
+		rt.SetChunkPlanner(planner)
+		if _, err = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil)); err != nil {
+			return 0, err
+		}
+		if b, _ := os.ReadFile(tfile.Name()); !bytes.Equal(b, serverBytes) {
+			return 0, errors.New("content differs")
+		}
+		res, _ := rt.Wait()
+		return res.Chunks, nil
+	}
+
+	Convey("When a chunk planner is set, it decides the workers from the probe", t, func() {
+		chunks, err := download(func(probe *http.Response) (int, int64) {
+			n, _ := strconv.Atoi(probe.Header.Get("X-Parallelism"))
+			return n, 0
+		})
+		So(err, ShouldBeNil)
+		So(chunks, ShouldEqual, 8)
+	})
+
+	Convey("When a chunk planner is set, it can decide the chunk size instead", t, func() {
+		chunks, err := download(func(probe *http.Response) (int, int64) {
+			return 0, probe.ContentLength / 5
+		})
+		So(err, ShouldBeNil)
+		So(chunks, ShouldEqual, 5)
+	})
+
+	Convey("When a chunk planner leaves things be, or there isn't one, the workers are as configured", t, func() {
+		chunks, err := download(func(*http.Response) (int, int64) { return 0, 0 })
+		So(err, ShouldBeNil)
+		So(chunks, ShouldEqual, 4)
+
+		chunks, err = download(nil)
+		So(err, ShouldBeNil)
+		So(chunks, ShouldEqual, 4)
+	})
+}
+
+func Test_WithPlan(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "wp")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, the plan is published before any chunks are fetched", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		plans := rt.WithPlan()
+
+		var planned int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet && len(plans) > 0 {
+				atomic.StoreInt32(&planned, 1)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(atomic.LoadInt32(&planned), ShouldEqual, 1)
+
+		pe := <-plans
+		So(pe.ContentLength, ShouldEqual, len(serverBytes))
+		So(pe.Offset, ShouldEqual, 0)
+		So(pe.Ranges, ShouldResemble, planChunks(int64(len(serverBytes)), 4, 0))
+		So(plans, ShouldHaveLength, 0)
+		_, open := <-plans
+		So(open, ShouldBeFalse)
+	})
+
+	Convey("When the plan changes more often than the chan holds, and nobody is reading, the download isn't held up", t, func() {
+		content := bytes.Repeat([]byte(`0123456789`), 20)
+
+		// The first HEAD says 100 bytes, the first GET says 200, and then it's 50 until the restart is done
+		var heads, gets int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			serve := content[:50]
+			if req.Method == http.MethodHead && atomic.AddInt32(&heads, 1) == 1 {
+				serve = content[:100]
+			} else if req.Method == http.MethodGet && atomic.AddInt32(&gets, 1) == 1 {
+				serve = content
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serve))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetShrinkRestarts(1)
+		plans := rt.WithPlan()
+
+		done := make(chan error, 1)
+		go func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			done <- rerr
+		}()
+
+		select {
+		case rerr := <-done:
+			So(rerr, ShouldBeNil)
+		case <-time.After(5 * time.Second):
+			So("RoundTrip returned", ShouldEqual, "RoundTrip hung")
+		}
+		So(atomic.LoadInt32(&heads), ShouldEqual, 2)
+
+		var events int
+		for range plans {
+			events++
+		}
+		So(events, ShouldEqual, cap(plans))
+	})
+}
+
+func Test_Scheduler(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "sched")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// backToFront schedules the default plan in reverse
+	backToFront := func(total int64, workers int) []Range {
+		chunks := planChunks(total, workers, 0)
+		for i, j := 0, len(chunks)-1; i < j; i, j = i+1, j-1 {
+			chunks[i], chunks[j] = chunks[j], chunks[i]
+		}
+		return chunks
+	}
+
+	// interleaved schedules 50-byte chunks, the even ones first
+	interleaved := func(total int64, workers int) []Range {
+		var evens, odds []Range
+		for i, c := range planChunks(total, 0, 50) {
+			if i%2 == 0 {
+				evens = append(evens, c)
+			} else {
+				odds = append(odds, c)
+			}
+		}
+		return append(evens, odds...)
+	}
+
+	Convey("When a scheduler is set, ranges are fetched in the order it says", t, func() {
+		var (
+			lock   sync.Mutex
+			ranges []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				lock.Lock()
+				ranges = append(ranges, req.Header.Get("Range"))
+				lock.Unlock()
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(1)
+		rt.SetScheduler(backToFront)
+		So(rt.ExpectedRequestCount(int64(len(serverBytes))), ShouldEqual, 5)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(ranges, ShouldResemble, []string{"bytes=300-399", "bytes=200-299", "bytes=100-199", "bytes=0-99"})
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When a scheduler is set, and the first chunk reports a different size than the probe, the rest is rescheduled", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				rw.Header().Set("Accept-Ranges", "bytes")
+				rw.Header().Set("Content-Length", "500")
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetScheduler(interleaved)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When a scheduler leaves a gap, the download fails before fetching anything", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetScheduler(func(total int64, workers int) []Range {
+			return []Range{{Start: 0, End: 10}, {Start: 20, End: total}}
+		})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(rerr.Error(), ShouldContainSubstring, "gap")
+		So(rt.RequestCount(), ShouldEqual, 1)
+	})
+
+	Convey("When a Range is subtracted from others, what's left is in order", t, func() {
+		ranges := []Range{{Start: 0, End: 10}, {Start: 30, End: 40}, {Start: 10, End: 30}}
+		So(subtractRange(ranges, Range{Start: 5, End: 15}), ShouldResemble,
+			[]Range{{Start: 0, End: 5}, {Start: 30, End: 40}, {Start: 15, End: 30}})
+		So(subtractRange(ranges, Range{Start: 0, End: 40}), ShouldBeEmpty)
+		So(subtractRange(ranges, Range{Start: 12, End: 14}), ShouldResemble,
+			[]Range{{Start: 0, End: 10}, {Start: 30, End: 40}, {Start: 10, End: 12}, {Start: 14, End: 30}})
+	})
+}
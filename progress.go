@@ -0,0 +1,257 @@
+package rangetripper
+
+import (
+	"go.uber.org/atomic"
+
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// countingReader counts what is read through it into a total shared with other readers
+type countingReader struct {
+	r     io.Reader
+	total *atomic.Int64
+	n     int64
+}
+
+// Read reads from the underlying Reader, counting what was read
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.total.Add(int64(n))
+	return n, err
+}
+
+// uncount takes back from the total what this reader has counted, e.g. because it will be read again
+func (c *countingReader) uncount() {
+	c.total.Sub(c.n)
+	c.n = 0
+}
+
+// SetProgressInterval sets a function to be called every “d“ while RoundTrip is running, and once more when it
+// is done, with the percentage of the content received so far, and the bytes per second received since the
+// last call. The percentage is -1 if the size of the content isn't known (yet). Unlike WithProgress, this is
+// independent of how and when chunks complete. A “d“ of 0 or a nil function disables it.
+func (rt *RangeTripper) SetProgressInterval(d time.Duration, progress func(pct float64, bps int64)) {
+	rt.progressEvery = d
+	rt.progressFunc = progress
+}
+
+// SetProgressJSONWriter sets a Writer to be sent a line of JSON every “d“ while RoundTrip is running, and once
+// more when it is done, like “{"done":N,"total":T,"bps":B,"pct":P}“, with the bytes received so far, the size
+// of the content, the bytes per second received since the last line, and the percentage received, as with
+// SetProgressInterval. Each line is written in one call, so it can be relayed as is, e.g. as a Server-Sent
+// Event. A “d“ of 0 or a nil Writer disables it.
+func (rt *RangeTripper) SetProgressJSONWriter(w io.Writer, d time.Duration) {
+	rt.progressJSONEvery = d
+	rt.progressJSON = w
+}
+
+// progressSample is the progress at one tick, as written by SetProgressJSONWriter
+type progressSample struct {
+	Done  int64   `json:"done"`
+	Total int64   `json:"total"`
+	BPS   int64   `json:"bps"`
+	Pct   float64 `json:"pct"`
+}
+
+// startProgressTicker starts calling the SetProgressInterval function, writing to the SetProgressJSONWriter
+// Writer, and sending to the WithThroughput chan, if any, and returns a func to stop them, which makes the final call and write before returning.
+func (rt *RangeTripper) startProgressTicker() func() {
+	var stops []func()
+	if rt.progressEvery > 0 && rt.progressFunc != nil {
+		stops = append(stops, rt.startTicker(rt.progressEvery, func(s progressSample) {
+			rt.progressFunc(s.Pct, s.BPS)
+		}))
+	}
+	if rt.progressJSONEvery > 0 && rt.progressJSON != nil {
+		stops = append(stops, rt.startTicker(rt.progressJSONEvery, func(s progressSample) {
+			if b, err := json.Marshal(s); err != nil {
+				rt.DebugOut.Printf("Error marshalling progress: %s\n", err)
+			} else if _, err = rt.progressJSON.Write(append(b, '\n')); err != nil {
+				rt.DebugOut.Printf("Error writing progress: %s\n", err)
+			}
+		}))
+	}
+	if rt.throughput != nil {
+		stops = append(stops, rt.startTicker(ThroughputInterval, rt.sendThroughput))
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// startTicker calls “report“ with a progressSample every “d“, and returns a func to stop it, which makes the
+// final call before returning.
+func (rt *RangeTripper) startTicker(d time.Duration, report func(progressSample)) func() {
+	var (
+		stop    = make(chan struct{})
+		stopped = make(chan struct{})
+		last    = time.Now()
+		lastN   int64
+	)
+
+	sample := func() {
+		var (
+			now = time.Now()
+			s   = progressSample{Done: rt.received.Load(), Total: rt.expected.Load(), Pct: -1}
+		)
+		if s.Total > 0 {
+			s.Pct = 100 * float64(s.Done) / float64(s.Total)
+		}
+		if elapsed := now.Sub(last); elapsed > 0 && s.Done > lastN {
+			// Nothing was received if it went down, e.g. because a restart discarded it
+			s.BPS = int64(float64(s.Done-lastN) / elapsed.Seconds())
+		}
+		last, lastN = now, s.Done
+		report(s)
+	}
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-stop:
+				sample()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// ProgressAccumulator consumes a WithProgress chan, keeping track of the total length of the content, how much of
+// it has been received, and how quickly, so callers needn't hand-roll the loop. It stops when the chan is closed,
+// which the RangeTripper does when it is done, even if RoundTrip fails before the total is known.
+type ProgressAccumulator struct {
+	total    atomic.Int64
+	received atomic.Int64
+	started  atomic.Time
+	stopped  atomic.Time
+	finished chan struct{}
+}
+
+// NewProgressAccumulator returns a ProgressAccumulator that has started consuming “progress“, which is usually
+// what WithProgress returned.
+func NewProgressAccumulator(progress <-chan int64) *ProgressAccumulator {
+	p := &ProgressAccumulator{
+		finished: make(chan struct{}),
+	}
+	p.total.Store(-1)
+
+	go func() {
+		defer close(p.finished)
+		defer func() { p.stopped.Store(time.Now()) }()
+
+		first := true
+		for n := range progress {
+			if first {
+				// first item is the contentLength
+				first = false
+				p.started.Store(time.Now())
+				p.total.Store(n)
+				continue
+			}
+			p.received.Add(n)
+		}
+	}()
+	return p
+}
+
+// Total returns the length of the content, or -1 if it isn't known (yet).
+func (p *ProgressAccumulator) Total() int64 {
+	return p.total.Load()
+}
+
+// Received returns how many bytes of the content have been received so far.
+func (p *ProgressAccumulator) Received() int64 {
+	return p.received.Load()
+}
+
+// BPS returns the average bytes per second received since the total was known, until the chan was closed.
+func (p *ProgressAccumulator) BPS() int64 {
+	started := p.started.Load()
+	if started.IsZero() {
+		return 0
+	}
+	until := p.stopped.Load()
+	if until.IsZero() {
+		until = time.Now()
+	}
+	if elapsed := until.Sub(started); elapsed > 0 {
+		return int64(float64(p.received.Load()) / elapsed.Seconds())
+	}
+	return 0
+}
+
+// Wait blocks until the WithProgress chan has been closed and drained, like a sync.WaitGroup.
+func (p *ProgressAccumulator) Wait() {
+	<-p.finished
+}
+
+// progressStep is the fewest bytes progressReader reports at once, other than the last of them
+const progressStep = 64 << 10
+
+// progressReader reports what is read through it to a WithProgress chan as it goes, so a download in one go
+// shows progress before it is done.
+type progressReader struct {
+	r       io.Reader
+	report  func(int64)
+	pending int64
+}
+
+// Read reads from the underlying Reader, reporting every progressStep bytes, and whatever is left at the end
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.pending += int64(n)
+	if p.pending >= progressStep || err != nil {
+		p.flush()
+	}
+	return n, err
+}
+
+// flush reports anything read but not yet reported
+func (p *progressReader) flush() {
+	if p.pending > 0 {
+		p.report(p.pending)
+		p.pending = 0
+	}
+}
+
+// reportTotal sends the length of the content to the WithProgress chan, if any, unless it already has been,
+// e.g. before chunks were abandoned for a download in one go. -1 means it isn't known.
+func (rt *RangeTripper) reportTotal(total int64) {
+	if rt.progress == nil || rt.sentTotal {
+		return
+	}
+	rt.sentTotal = true
+	rt.progress <- total
+}
+
+// sendProgress sends “n“ bytes to the WithProgress chan, if any, keeping count of what has been sent
+func (rt *RangeTripper) sendProgress(n int64) {
+	if rt.progress == nil || n == 0 {
+		return
+	}
+	rt.sentBytes.Add(n)
+	rt.progress <- n
+}
+
+// settleProgress sends whatever it takes for what has been sent to the WithProgress chan to add up to “n“,
+// e.g. a negative byte-length to take back what a restart discarded.
+func (rt *RangeTripper) settleProgress(n int64) {
+	rt.sendProgress(n - rt.sentBytes.Load())
+}
@@ -0,0 +1,240 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_ProgressInterval(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pi")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := make([]byte, 4000)
+
+	// A server that trickles out the content, so there's time to tick
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Accept-Ranges", "bytes")
+		var start, end int
+		if rh := req.Header.Get("Range"); rh != "" {
+			fmt.Sscanf(rh, "bytes=%d-%d", &start, &end)
+			rw.Header().Set("Content-Range", "bytes "+strconv.Itoa(start)+"-"+strconv.Itoa(end)+"/"+strconv.Itoa(len(serverBytes)))
+			rw.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			rw.WriteHeader(http.StatusPartialContent)
+		} else {
+			end = len(serverBytes) - 1
+			rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+		}
+		if req.Method == http.MethodHead {
+			return
+		}
+		for i := start; i <= end; i += 100 {
+			j := i + 100
+			if j > end+1 {
+				j = end + 1
+			}
+			rw.Write(serverBytes[i:j])
+			rw.(http.Flusher).Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	Convey("When a progress interval is set, the function is called regularly, and finally with 100%", t, func() {
+		for _, threshold := range []int64{0, 1 << 20} {
+			var (
+				lock sync.Mutex
+				pcts []float64
+				bps  int64
+			)
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetParallelThreshold(threshold)
+			rt.SetProgressInterval(20*time.Millisecond, func(pct float64, b int64) {
+				lock.Lock()
+				defer lock.Unlock()
+				pcts = append(pcts, pct)
+				if b > bps {
+					bps = b
+				}
+			})
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			lock.Lock()
+			So(len(pcts), ShouldBeGreaterThan, 2)
+			So(pcts[len(pcts)-1], ShouldEqual, 100)
+			for i := 1; i < len(pcts); i++ {
+				So(pcts[i], ShouldBeGreaterThanOrEqualTo, pcts[i-1])
+			}
+			So(bps, ShouldBeGreaterThan, 0)
+			lock.Unlock()
+		}
+	})
+}
+
+func Test_ProgressJSONWriter(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pj")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := make([]byte, 4000)
+
+	// A server that trickles out the content, so there's time to tick
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+	}))
+	defer server.Close()
+
+	Convey("When a progress JSON Writer is set, a line of JSON is written regularly, and finally with 100%", t, func() {
+		var buf bytes.Buffer
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetProgressJSONWriter(&buf, 20*time.Millisecond)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		So(len(lines), ShouldBeGreaterThan, 2)
+
+		var last map[string]any
+		So(json.Unmarshal([]byte(lines[len(lines)-1]), &last), ShouldBeNil)
+		So(last, ShouldResemble, map[string]any{"done": 4000.0, "total": 4000.0, "bps": last["bps"], "pct": 100.0})
+		So(lines[0], ShouldContainSubstring, `"pct":`)
+	})
+}
+
+func Test_ProgressAccumulator(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pa")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a ProgressAccumulator consumes WithProgress, it has the whole of the content when RoundTrip is done", t, func() {
+		serverBytes := bytes.Repeat([]byte("0123456789"), 1000)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		acc := NewProgressAccumulator(rt.WithProgress())
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		acc.Wait()
+		So(acc.Total(), ShouldEqual, len(serverBytes))
+		So(acc.Received(), ShouldEqual, len(serverBytes))
+		So(acc.BPS(), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("When RoundTrip fails before the total is known, a ProgressAccumulator still stops", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		acc := NewProgressAccumulator(rt.WithProgress())
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+
+		acc.Wait()
+		So(acc.Total(), ShouldEqual, -1)
+		So(acc.Received(), ShouldEqual, 0)
+		So(acc.BPS(), ShouldEqual, 0)
+	})
+}
+
+func Test_ProgressUnranged(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pu")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 30000)
+
+	// collect returns everything sent to the WithProgress chan of a download from a server that doesn't support
+	// ranges, and sets a Content-Length if “withLength“
+	collect := func(withLength bool) ([]int64, error) {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if withLength {
+				rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+			}
+			rw.Write(serverBytes)
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		if err != nil {
+			return nil, err
+		}
+		progress := rt.WithProgress()
+
+		var (
+			sent []int64
+			done = make(chan struct{})
+		)
+		go func() {
+			defer close(done)
+			for n := range progress {
+				sent = append(sent, n)
+			}
+		}()
+
+		_, err = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		<-done
+		return sent, err
+	}
+
+	Convey("When the content is downloaded in one go, progress is reported as it arrives", t, func() {
+		sent, err := collect(true)
+		So(err, ShouldBeNil)
+		So(len(sent), ShouldBeGreaterThan, 2)
+		So(sent[0], ShouldEqual, len(serverBytes))
+
+		var count int64
+		for _, n := range sent[1:] {
+			count += n
+		}
+		So(count, ShouldEqual, len(serverBytes))
+	})
+
+	Convey("When the content is downloaded in one go, and its length isn't known, the total is -1", t, func() {
+		sent, err := collect(false)
+		So(err, ShouldBeNil)
+		So(len(sent), ShouldBeGreaterThan, 2)
+		So(sent[0], ShouldEqual, -1)
+
+		var count int64
+		for _, n := range sent[1:] {
+			count += n
+		}
+		So(count, ShouldEqual, len(serverBytes))
+	})
+}
@@ -0,0 +1,80 @@
+package rangetripper
+
+import (
+	"sync"
+	"time"
+)
+
+// RangeSupportCache remembers whether hosts support byte ranges, so RangeTrippers downloading from a host
+// already known to support them can skip the HEAD, and probe with a small ranged GET instead. A single
+// RangeSupportCache is meant to be shared by many RangeTrippers, so implementations must be safe for concurrent use.
+type RangeSupportCache interface {
+	// Get returns whether “host“ supports ranges, and whether that is known at all
+	Get(host string) (supported, ok bool)
+	// Set records whether “host“ supports ranges
+	Set(host string, supported bool)
+}
+
+// rangeSupportEntry is what a memoryRangeSupportCache knows about a host
+type rangeSupportEntry struct {
+	supported bool
+	expires   time.Time
+}
+
+// memoryRangeSupportCache is an in-memory RangeSupportCache whose entries expire
+type memoryRangeSupportCache struct {
+	lock  sync.Mutex
+	ttl   time.Duration
+	hosts map[string]rangeSupportEntry
+}
+
+// NewRangeSupportCache returns an in-memory RangeSupportCache that forgets what it knows about a host “ttl“
+// after it was last Set, since what a host supports can change. A “ttl“ less than 1 means entries never expire.
+func NewRangeSupportCache(ttl time.Duration) RangeSupportCache {
+	return &memoryRangeSupportCache{
+		ttl:   ttl,
+		hosts: make(map[string]rangeSupportEntry),
+	}
+}
+
+// Get returns whether “host“ supports ranges, and whether that is known and unexpired
+func (c *memoryRangeSupportCache) Get(host string) (bool, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.hosts[host]
+	if !ok {
+		return false, false
+	} else if c.ttl > 0 && time.Now().After(e.expires) {
+		delete(c.hosts, host)
+		return false, false
+	}
+	return e.supported, true
+}
+
+// Set records whether “host“ supports ranges
+func (c *memoryRangeSupportCache) Set(host string, supported bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.hosts[host] = rangeSupportEntry{
+		supported: supported,
+		expires:   time.Now().Add(c.ttl),
+	}
+}
+
+// SetRangeSupportCache sets a RangeSupportCache to consult before probing, and to update after. If the host
+// of the request is known to support ranges, the HEAD is skipped in favor of a small ranged GET, which both
+// confirms it and discovers the size in one request. If that GET doesn't pan out, the usual HEAD is made.
+func (rt *RangeTripper) SetRangeSupportCache(cache RangeSupportCache) {
+	rt.rangeCache = cache
+}
+
+// knownRanges returns true if the RangeSupportCache, if any, says “host“ supports ranges
+func (rt *RangeTripper) knownRanges(host string) bool {
+	if rt.rangeCache == nil {
+		return false
+	}
+	supported, ok := rt.rangeCache.Get(host)
+	return ok && supported
+}
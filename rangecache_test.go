@@ -0,0 +1,91 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/atomic"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_RangeSupportCache(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rsc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When a RangeSupportCache is created, it remembers hosts until the TTL expires", t, func() {
+		cache := NewRangeSupportCache(50 * time.Millisecond)
+		_, ok := cache.Get("example.com")
+		So(ok, ShouldBeFalse)
+
+		cache.Set("example.com", true)
+		supported, ok := cache.Get("example.com")
+		So(ok, ShouldBeTrue)
+		So(supported, ShouldBeTrue)
+
+		time.Sleep(60 * time.Millisecond)
+		_, ok = cache.Get("example.com")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("When RangeTrippers share a RangeSupportCache, only the first HEADs a host that supports ranges", t, func() {
+		var heads atomic.Int64
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				heads.Inc()
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		cache := NewRangeSupportCache(time.Minute)
+		for i := 0; i < 3; i++ {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetRangeSupportCache(cache)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+		}
+		So(heads.Load(), ShouldEqual, 1)
+	})
+
+	Convey("When a cached host no longer supports ranges, the download still completes, and the cache is corrected", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes)
+		}))
+		defer server.Close()
+
+		cache := NewRangeSupportCache(time.Minute)
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRangeSupportCache(cache)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		cache.Set(req.URL.Host, true)
+
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+
+		supported, ok := cache.Get(req.URL.Host)
+		So(ok, ShouldBeTrue)
+		So(supported, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,191 @@
+// Package rangetrippertest provides a rangetripper.Client for testing code that uses RangeTripper, without
+// needing a real HTTP server.
+package rangetrippertest
+
+import (
+	"github.com/cognusion/go-rangetripper"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request is what was asked of a Client
+type Request struct {
+	Method string
+	URL    string
+	Range  string
+}
+
+// Client is a rangetripper.Client that serves Content, honoring Range requests, and records every request it
+// receives. Responses, Delays, and Errors are keyed by the Range header of the request ("" for none), and let
+// specific requests be programmed to behave differently. Requests are handled one at a time, as though over a
+// single connection, so the order they are recorded in is the order they were answered in.
+type Client struct {
+	// Content is served for any request that isn't otherwise handled
+	Content []byte
+	// Responses maps a Range header to a function returning the Response to it
+	Responses map[string]func(*http.Request) *http.Response
+	// Delays maps a Range header to how long to wait before responding to it
+	Delays map[string]time.Duration
+	// Errors maps a Range header to an error to return instead of responding to it
+	Errors map[string]error
+
+	lock     sync.Mutex
+	requests []Request
+	replay   map[string][]rangetripper.TraceEntry
+}
+
+// NewClient returns a Client serving the specified content
+func NewClient(content []byte) *Client {
+	return &Client{
+		Content:   content,
+		Responses: make(map[string]func(*http.Request) *http.Response),
+		Delays:    make(map[string]time.Duration),
+		Errors:    make(map[string]error),
+	}
+}
+
+// Replay programs the Client to answer requests as recorded by RangeTripper.RequestTrace, so a download can be
+// reproduced. Each request is answered as the next unreplayed entry with the same Method, URL, and Range was:
+// after the same Duration, with the same error, or with the same status. Successful statuses are served from
+// Content, as that isn't in the trace. Requests with no entry left are handled as though there were no trace.
+func (c *Client) Replay(trace []rangetripper.TraceEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.replay = make(map[string][]rangetripper.TraceEntry)
+	for _, te := range trace {
+		k := replayKey(te.Method, te.URL, te.Range)
+		c.replay[k] = append(c.replay[k], te)
+	}
+}
+
+// replayKey returns the key a request is replayed by
+func replayKey(method, url, rh string) string {
+	return method + " " + url + " " + rh
+}
+
+// nextReplay returns the next entry for the request, if any, and consumes it. The lock must be held.
+func (c *Client) nextReplay(req *http.Request, rh string) (rangetripper.TraceEntry, bool) {
+	k := replayKey(req.Method, req.URL.String(), rh)
+	entries := c.replay[k]
+	if len(entries) == 0 {
+		return rangetripper.TraceEntry{}, false
+	}
+	c.replay[k] = entries[1:]
+	return entries[0], true
+}
+
+// Requests returns a copy of the requests received so far, in the order they were answered
+func (c *Client) Requests() []Request {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]Request(nil), c.requests...)
+}
+
+// Do records the request, and returns the programmed or default Response for it
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	rh := req.Header.Get("Range")
+	c.requests = append(c.requests, Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Range:  rh,
+	})
+
+	if te, ok := c.nextReplay(req, rh); ok {
+		return c.replayed(req, rh, te)
+	}
+
+	if d := c.Delays[rh]; d > 0 {
+		select {
+		case <-time.After(d):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if err := c.Errors[rh]; err != nil {
+		return nil, err
+	}
+
+	if f := c.Responses[rh]; f != nil {
+		return f(req), nil
+	}
+
+	return c.serve(req, rh), nil
+}
+
+// replayed answers the request as the TraceEntry says it was
+func (c *Client) replayed(req *http.Request, rh string, te rangetripper.TraceEntry) (*http.Response, error) {
+	if te.Duration > 0 {
+		select {
+		case <-time.After(te.Duration):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if te.Error != "" {
+		return nil, errors.New(te.Error)
+	} else if te.Status < 200 || te.Status >= 300 {
+		return response(req, te.Status, make(http.Header), nil), nil
+	}
+	return c.serve(req, rh), nil
+}
+
+// serve returns the default Response for the request: all of the Content, or the requested range of it
+func (c *Client) serve(req *http.Request, rh string) *http.Response {
+	var (
+		total  = int64(len(c.Content))
+		start  int64
+		end    = total - 1
+		status = http.StatusOK
+		header = make(http.Header)
+	)
+	header.Set("Accept-Ranges", "bytes")
+
+	if rh != "" {
+		// Only single ranges with both ends are supported, which is all RangeTripper asks for
+		if n, err := fmt.Sscanf(rh, "bytes=%d-%d", &start, &end); n != 2 || err != nil || start > end || start >= total {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", total))
+			return response(req, http.StatusRequestedRangeNotSatisfiable, header, nil)
+		}
+		if end >= total {
+			end = total - 1
+		}
+		status = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+	}
+
+	body := c.Content[start : end+1]
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return response(req, status, header, body)
+}
+
+// response assembles a Response
+func response(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,138 @@
+package rangetrippertest
+
+import (
+	"github.com/cognusion/go-rangetripper"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Client(t *testing.T) {
+	content := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When a Client is asked for things, it serves them and records them", t, func() {
+		c := NewClient(content)
+
+		req, _ := http.NewRequest("HEAD", "http://example.com/file", nil)
+		res, err := c.Do(req)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusOK)
+		So(res.Header.Get("Content-Length"), ShouldEqual, "39")
+		So(res.Header.Get("Accept-Ranges"), ShouldEqual, "bytes")
+
+		req, _ = http.NewRequest("GET", "http://example.com/file", nil)
+		req.Header.Set("Range", "bytes=3-8")
+		res, err = c.Do(req)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusPartialContent)
+		So(res.Header.Get("Content-Range"), ShouldEqual, "bytes 3-8/39")
+		body, _ := io.ReadAll(res.Body)
+		So(string(body), ShouldEqual, "I have")
+
+		req, _ = http.NewRequest("GET", "http://example.com/file", nil)
+		req.Header.Set("Range", "bytes=100-200")
+		res, err = c.Do(req)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusRequestedRangeNotSatisfiable)
+
+		So(c.Requests(), ShouldResemble, []Request{
+			{Method: "HEAD", URL: "http://example.com/file"},
+			{Method: "GET", URL: "http://example.com/file", Range: "bytes=3-8"},
+			{Method: "GET", URL: "http://example.com/file", Range: "bytes=100-200"},
+		})
+	})
+
+	Convey("When a Client is programmed, it does as it is told", t, func() {
+		c := NewClient(content)
+		errNope := errors.New("nope")
+		c.Errors["bytes=0-1"] = errNope
+		c.Delays["bytes=2-3"] = 20 * time.Millisecond
+		c.Responses["bytes=4-5"] = func(req *http.Request) *http.Response {
+			return &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody, Request: req}
+		}
+
+		req, _ := http.NewRequest("GET", "http://example.com/file", nil)
+		req.Header.Set("Range", "bytes=0-1")
+		_, err := c.Do(req)
+		So(err, ShouldEqual, errNope)
+
+		req.Header.Set("Range", "bytes=2-3")
+		start := time.Now()
+		res, err := c.Do(req)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusPartialContent)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = c.Do(req.WithContext(ctx))
+		So(err, ShouldEqual, context.Canceled)
+
+		req.Header.Set("Range", "bytes=4-5")
+		res, err = c.Do(req)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusTeapot)
+
+		So(c.Requests(), ShouldHaveLength, 4)
+	})
+}
+
+func Test_Replay(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "replay")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	content := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When a trace of a failed download is replayed, the failure is reproduced", t, func() {
+		// The field failure: one chunk always errors
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if strings.HasPrefix(req.Header.Get("Range"), "bytes=9-") {
+				rw.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, strings.NewReader(string(content)))
+		}))
+		defer server.Close()
+
+		rt, err := rangetripper.New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+
+		trace := rt.RequestTrace()
+		So(len(trace), ShouldBeGreaterThan, 1)
+		So(trace[0].Method, ShouldEqual, "HEAD")
+		So(trace[0].Status, ShouldEqual, http.StatusOK)
+
+		// The reproduction, without the server
+		c := NewClient(content)
+		c.Replay(trace)
+		rt, err = rangetripper.New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(c)
+		_, perr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(perr, ShouldNotBeNil)
+		So(perr.Error(), ShouldEqual, rerr.Error())
+
+		// Workers may stop being spawned at a different point, but nothing is asked that wasn't before
+		recorded := make(map[string]bool)
+		for _, te := range trace {
+			recorded[te.Method+" "+te.Range] = true
+		}
+		for _, r := range c.Requests() {
+			So(recorded[r.Method+" "+r.Range], ShouldBeTrue)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package rangetrippertest
+
+import (
+	"github.com/cognusion/go-rangetripper"
+
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// NewHandler returns an http.Handler that serves “content“ from memory, honoring HEAD and Range requests,
+// and advertising Accept-Ranges, like a well-behaved origin. Unlike Client, it answers requests concurrently,
+// so it is suited to measuring throughput.
+func NewHandler(content []byte) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+	})
+}
+
+// NewServer returns a started httptest.Server using NewHandler. The caller must Close it.
+func NewServer(content []byte) *httptest.Server {
+	return httptest.NewServer(NewHandler(content))
+}
+
+// Content returns “size“ bytes of pseudo-random content, the same every time for a given size.
+func Content(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	return b
+}
+
+// BenchmarkDownload downloads “url“, which is “size“ bytes, b.N times, each with a new RangeTripper of “workers“
+// workers writing to a temporary file. If “configure“ isn't nil, it is called with each RangeTripper before it
+// is used, e.g. to SetChunkSize or SetClient. Throughput is reported in bytes per second.
+func BenchmarkDownload(b *testing.B, url string, size int64, workers int, configure func(*rangetripper.RangeTripper)) {
+	b.Helper()
+	b.SetBytes(size)
+
+	dir := b.TempDir()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rt, err := rangetripper.New(workers, filepath.Join(dir, fmt.Sprintf("bench-%d", i)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if configure != nil {
+			configure(rt)
+		}
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = rt.RoundTrip(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package rangetrippertest
+
+import (
+	"github.com/cognusion/go-rangetripper"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Server(t *testing.T) {
+	Convey("When Content is asked for, it is the size asked for, and the same each time", t, func() {
+		So(Content(1000), ShouldHaveLength, 1000)
+		So(Content(1000), ShouldResemble, Content(1000))
+		So(bytes.Equal(Content(1000), Content(1001)[:1000]), ShouldBeFalse)
+	})
+
+	Convey("When a Server is started, it honors ranges, and RangeTripper can download from it", t, func() {
+		content := Content(100 * 1024)
+		server := NewServer(content)
+		defer server.Close()
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Range", "bytes=10-19")
+		res, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer res.Body.Close()
+		So(res.StatusCode, ShouldEqual, http.StatusPartialContent)
+		body, _ := io.ReadAll(res.Body)
+		So(body, ShouldResemble, content[10:20])
+
+		out := filepath.Join(t.TempDir(), "out")
+		rt, err := rangetripper.New(10, out)
+		So(err, ShouldBeNil)
+
+		req, _ = http.NewRequest("GET", server.URL, nil)
+		_, err = rt.RoundTrip(req)
+		So(err, ShouldBeNil)
+
+		b, err := os.ReadFile(out)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, content)
+	})
+}
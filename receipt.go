@@ -0,0 +1,98 @@
+package rangetripper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Receipt is the record of a completed download written by SetWriteReceipt
+type Receipt struct {
+	// URL is the URL that was requested
+	URL string `json:"url"`
+	// FinalURL is the URL the content came from, after any redirects
+	FinalURL string `json:"final_url"`
+	// Path is where the content was downloaded to
+	Path string `json:"path"`
+	// Size is the number of bytes in the output file
+	Size int64 `json:"size"`
+	// SHA256 is the hex-encoded SHA-256 hash of the output file
+	SHA256 string `json:"sha256"`
+	// ETag is the ETag header of the response, if any
+	ETag string `json:"etag,omitempty"`
+	// LastModified is the Last-Modified header of the response, if any
+	LastModified string `json:"last_modified,omitempty"`
+	// Ranged is true if the content was downloaded in chunks
+	Ranged bool `json:"ranged"`
+	// Chunks is the number of chunks the content was downloaded in, if Ranged
+	Chunks int `json:"chunks,omitempty"`
+	// Workers is the most chunks that could be downloaded at once
+	Workers int `json:"workers"`
+	// Duration is how long the download took, e.g. “1.5s“
+	Duration string `json:"duration"`
+}
+
+// SetWriteReceipt sets a path to write a Receipt to, as JSON, once RoundTrip has completed successfully, as a
+// record of where the download came from, and what it was. The receipt is written to a temporary file alongside
+// “path“, and renamed over it, so it is never seen half-written. If it can't be written, RoundTrip returns the
+// error, although the download itself is complete. An empty path, the default, disables it.
+func (rt *RangeTripper) SetWriteReceipt(path string) {
+	rt.receiptPath = path
+}
+
+// writeReceipt writes the Receipt for the completed download to the SetWriteReceipt path.
+func (rt *RangeTripper) writeReceipt() error {
+	f, err := os.Open(rt.toFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(Receipt{
+		URL:          rt.result.URL,
+		FinalURL:     rt.result.FinalURL,
+		Path:         rt.toFile,
+		Size:         rt.result.Size,
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		ETag:         rt.result.ETag,
+		LastModified: rt.result.LastModified,
+		Ranged:       rt.result.Ranged,
+		Chunks:       rt.result.Chunks,
+		Workers:      rt.maxWorkers,
+		Duration:     rt.result.Duration.String(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(rt.receiptPath, append(b, '\n'))
+}
+
+// writeFileAtomic writes “b“ to a temporary file alongside “path“, and renames it over “path“, so it is never
+// seen half-written.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // harmless once renamed
+
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	} else if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	} else if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
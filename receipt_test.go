@@ -0,0 +1,94 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_WriteReceipt(t *testing.T) {
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+	sum := sha256.Sum256(serverBytes)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/old":
+			http.Redirect(rw, req, "/new", http.StatusFound)
+		case "/new":
+			rw.Header().Set("ETag", `"v1"`)
+			http.ServeContent(rw, req, "", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), bytes.NewReader(serverBytes))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	receipt := filepath.Join(dir, "file.receipt.json")
+
+	Convey("When a download with a receipt succeeds, the receipt records it", t, func() {
+		rt, err := New(4, path)
+		So(err, ShouldBeNil)
+		rt.SetWriteReceipt(receipt)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL+"/old", nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(receipt)
+		So(err, ShouldBeNil)
+		var r Receipt
+		So(json.Unmarshal(b, &r), ShouldBeNil)
+		So(r.URL, ShouldEqual, server.URL+"/old")
+		So(r.FinalURL, ShouldEqual, server.URL+"/new")
+		So(r.Path, ShouldEqual, path)
+		So(r.Size, ShouldEqual, len(serverBytes))
+		So(r.SHA256, ShouldEqual, hex.EncodeToString(sum[:]))
+		So(r.ETag, ShouldEqual, `"v1"`)
+		So(r.LastModified, ShouldEqual, "Thu, 02 Jan 2020 03:04:05 GMT")
+		So(r.Ranged, ShouldBeTrue)
+		So(r.Chunks, ShouldEqual, 4)
+		So(r.Workers, ShouldEqual, 5)
+		So(r.Duration, ShouldNotBeEmpty)
+
+		result, werr := rt.Wait()
+		So(werr, ShouldBeNil)
+		So(result.FinalURL, ShouldEqual, server.URL+"/new")
+
+		So(os.Remove(receipt), ShouldBeNil)
+	})
+
+	Convey("When a download with a receipt fails, no receipt is written", t, func() {
+		rt, err := New(4, path)
+		So(err, ShouldBeNil)
+		rt.SetWriteReceipt(receipt)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL+"/missing", nil))
+		So(rerr, ShouldNotBeNil)
+
+		_, err = os.Stat(receipt)
+		So(errors.Is(err, fs.ErrNotExist), ShouldBeTrue)
+	})
+
+	Convey("When the receipt can't be written, the error is returned", t, func() {
+		rt, err := New(4, path)
+		So(err, ShouldBeNil)
+		rt.SetWriteReceipt(filepath.Join(dir, "nope", "receipt.json"))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL+"/new", nil))
+		So(rerr, ShouldNotBeNil)
+		So(rt.Err(), ShouldEqual, rerr)
+	})
+}
@@ -0,0 +1,52 @@
+package rangetripper
+
+import (
+	"fmt"
+)
+
+// ForbiddenError is returned, wrapped, when a chunk is refused with a 403, as when a presigned URL has expired
+const ForbiddenError = rtError("server refused the request, the URL may have expired")
+
+// SetURLRefresher sets a function to get a fresh URL, e.g. with a new signature, when a chunk is refused with
+// a 403 because the “old“ one has expired. The chunk is then retried from the new URL, up to the SetChunkRetries
+// limit, as are all chunks that start after. However many chunks are refused with the same URL, the function
+// is called once for it, so it needn't be safe for concurrent use. If it returns an error, or the URL it was
+// given, the chunk fails with both errors wrapped.
+func (rt *RangeTripper) SetURLRefresher(refresh func(old string) (string, error)) {
+	rt.refresher = refresh
+}
+
+// latestURL returns the URL that “url“ was most recently refreshed to, or “url“ if it hasn't been.
+func (rt *RangeTripper) latestURL(url string) string {
+	rt.refreshLock.Lock()
+	defer rt.refreshLock.Unlock()
+
+	for next, ok := rt.refreshed[url]; ok; next, ok = rt.refreshed[url] {
+		url = next
+	}
+	return url
+}
+
+// refreshURL returns the fresh URL for “old“, calling the SetURLRefresher function unless another chunk already
+// has.
+func (rt *RangeTripper) refreshURL(old string) (string, error) {
+	rt.refreshLock.Lock()
+	if _, ok := rt.refreshed[old]; ok {
+		rt.refreshLock.Unlock()
+		return rt.latestURL(old), nil
+	}
+	defer rt.refreshLock.Unlock()
+
+	url, err := rt.refresher(old)
+	if err != nil {
+		return "", err
+	} else if _, ok := rt.refreshed[url]; ok || url == old {
+		return "", fmt.Errorf("refreshed URL '%s' has already been refused", url)
+	}
+
+	if rt.refreshed == nil {
+		rt.refreshed = make(map[string]string)
+	}
+	rt.refreshed[old] = url
+	return url, nil
+}
@@ -0,0 +1,89 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_URLRefresher(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "refresh")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// expiring returns a server that only accepts the current signature, which changes after two ranges, and the
+	// URL for each signature
+	expiring := func() (*httptest.Server, func(int32) string) {
+		var (
+			ranges atomic.Int32
+			sig    atomic.Int32
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Get("sig") != string(rune('a'+sig.Load())) {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if req.Header.Get("Range") != "" && ranges.Add(1) == 2 {
+				defer sig.Add(1)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		return server, func(n int32) string {
+			return server.URL + "/?sig=" + string(rune('a'+n))
+		}
+	}
+
+	Convey("When a URL expires partway, it is refreshed once, and the refused chunks are retried", t, func() {
+		for _, client := range []Client{new(http.Client), NewRetryClient(3, 10*time.Millisecond, time.Second)} {
+			server, signed := expiring()
+
+			var refreshes atomic.Int32
+			rt, err := New(1, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(client)
+			rt.SetChunkSize(40)
+			rt.SetURLRefresher(func(old string) (string, error) {
+				if old != signed(refreshes.Load()) {
+					return "", errors.New("wrong URL to refresh")
+				}
+				return signed(refreshes.Add(1)), nil
+			})
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", signed(0), nil))
+			So(rerr, ShouldBeNil)
+			So(refreshes.Load(), ShouldEqual, 1)
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+			server.Close()
+		}
+	})
+
+	Convey("When a URL expires partway, and there's no refresher, or it fails, the download fails with ForbiddenError", t, func() {
+		for _, refresher := range []func(string) (string, error){nil, func(old string) (string, error) { return old, nil }} {
+			server, signed := expiring()
+
+			rt, err := New(1, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetChunkSize(40)
+			rt.SetURLRefresher(refresher)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", signed(0), nil))
+			So(errors.Is(rerr, ForbiddenError), ShouldBeTrue)
+			server.Close()
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package rangetripper
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// RangedHeader is set on the Response RoundTrip returns to "true" if the content was downloaded in chunks,
+	// otherwise "false"
+	RangedHeader = "X-RangeTripper-Ranged"
+	// ChunksHeader is set on the Response RoundTrip returns to the number of chunks the content was downloaded
+	// in, or 0 if it wasn't
+	ChunksHeader = "X-RangeTripper-Chunks"
+)
+
+// normalizeResponse makes the Response of a successful RoundTrip look the same whichever way the content was
+// probed and downloaded: a 200, without a Content-Range, with the size of the output file as its Content-Length,
+// an Accept-Ranges of "bytes" or "none" for whether the server supports ranges, and the RangedHeader and
+// ChunksHeader.
+func (rt *RangeTripper) normalizeResponse(res *http.Response) {
+	if res.Header == nil {
+		res.Header = make(http.Header)
+	}
+
+	res.StatusCode = http.StatusOK
+	res.Status = "200 OK"
+	res.ContentLength = rt.result.Size
+	res.Header.Set("Content-Length", strconv.FormatInt(rt.result.Size, 10))
+	res.Header.Del("Content-Range")
+	if rt.rangesOK {
+		res.Header.Set("Accept-Ranges", "bytes")
+	} else {
+		res.Header.Set("Accept-Ranges", "none")
+	}
+	res.Header.Set(RangedHeader, strconv.FormatBool(rt.result.Ranged))
+	res.Header.Set(ChunksHeader, strconv.Itoa(rt.result.Chunks))
+}
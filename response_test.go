@@ -0,0 +1,107 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_NormalizedResponse(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "nr")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 40)
+	size := strconv.Itoa(len(serverBytes))
+
+	for _, tc := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		configure func(*RangeTripper)
+		accept    string
+		ranged    string
+		chunks    string
+	}{
+		{
+			name: "a HEAD, and ranges",
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+			},
+			accept: "bytes", ranged: "true", chunks: "4",
+		},
+		{
+			name: "a HEAD, and no ranges",
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Content-Length", size)
+				rw.Write(serverBytes)
+			},
+			accept: "none", ranged: "false", chunks: "0",
+		},
+		{
+			name: "a HEAD, and ranges, but under the parallel threshold",
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+			},
+			configure: func(rt *RangeTripper) { rt.SetParallelThreshold(1000) },
+			accept:    "bytes", ranged: "false", chunks: "0",
+		},
+		{
+			name: "a forbidden HEAD, and a ranged GET",
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodHead {
+					rw.WriteHeader(http.StatusForbidden)
+					return
+				}
+				http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+			},
+			accept: "bytes", ranged: "true", chunks: "4",
+		},
+		{
+			name: "a forbidden HEAD, and a ranged GET that returns everything",
+			handler: func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodHead {
+					rw.WriteHeader(http.StatusForbidden)
+					return
+				}
+				rw.Header().Set("Content-Length", size)
+				rw.Write(serverBytes)
+			},
+			accept: "none", ranged: "false", chunks: "0",
+		},
+	} {
+		Convey("When the content is downloaded after "+tc.name+", the Response is normalized", t, func() {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client))
+			if tc.configure != nil {
+				tc.configure(rt)
+			}
+
+			res, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, http.StatusOK)
+			So(res.ContentLength, ShouldEqual, len(serverBytes))
+			So(res.Header.Get("Content-Length"), ShouldEqual, size)
+			So(res.Header.Get("Content-Range"), ShouldBeEmpty)
+			So(res.Header.Get("Accept-Ranges"), ShouldEqual, tc.accept)
+			So(res.Header.Get(RangedHeader), ShouldEqual, tc.ranged)
+			So(res.Header.Get(ChunksHeader), ShouldEqual, tc.chunks)
+
+			b, err := os.ReadFile(tfile.Name())
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, serverBytes)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package rangetripper
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// DownloadResult is a summary of a completed download
+type DownloadResult struct {
+	// URL is the URL that was requested
+	URL string
+	// FinalURL is the URL the content came from, after any redirects
+	FinalURL string
+	// Size is the number of bytes in the output file
+	Size int64
+	// Ranged is true if the content was downloaded in chunks
+	Ranged bool
+	// Chunks is the number of chunks the content was downloaded in, if Ranged
+	Chunks int
+	// ETag is the ETag header of the response, if any
+	ETag string
+	// LastModified is the Last-Modified header of the response, if any
+	LastModified string
+	// Duration is how long the download took
+	Duration time.Duration
+	// TTFBMin, TTFBMedian, and TTFBMax summarize how long the origin took to start responding to the request
+	// for each chunk, if Ranged (see ChunkProgress)
+	TTFBMin    time.Duration
+	TTFBMedian time.Duration
+	TTFBMax    time.Duration
+}
+
+// Wait blocks until RoundTrip has completed, and returns a summary of the download and the error RoundTrip
+// returned, if any. It may be called before, during, or after RoundTrip, from any number of goroutines,
+// but will block forever if RoundTrip is never called. Stream and WriteParts complete too: Stream once its
+// reader has been read to the end or closed, with the error reading it, if any, and WriteParts when it returns.
+func (rt *RangeTripper) Wait() (DownloadResult, error) {
+	<-rt.done
+	return rt.result, rt.finalErr
+}
+
+// Done returns a channel that is closed when RoundTrip, Stream, or WriteParts has completed (see Wait).
+func (rt *RangeTripper) Done() <-chan struct{} {
+	return rt.done
+}
+
+// Err returns nil if RoundTrip, Stream, or WriteParts has not yet completed (see Wait), otherwise the error it
+// completed with, if any.
+func (rt *RangeTripper) Err() error {
+	select {
+	case <-rt.done:
+		return rt.finalErr
+	default:
+		return nil
+	}
+}
+
+// finish records the outcome of RoundTrip, normalizes the Response and writes the SetWriteReceipt receipt if it
+// succeeded, and settles it. It returns “err“, or the error writing the receipt.
+func (rt *RangeTripper) finish(r *http.Request, res *http.Response, err error, start time.Time) error {
+	if r.URL != nil {
+		rt.result.URL = r.URL.String()
+	}
+	rt.result.FinalURL = rt.result.URL
+	rt.result.Duration = time.Since(start)
+	rt.summarizeTTFB()
+	if res != nil {
+		rt.result.ETag = res.Header.Get("ETag")
+		rt.result.LastModified = res.Header.Get("Last-Modified")
+		if res.Request != nil {
+			rt.result.FinalURL = res.Request.URL.String()
+		}
+	}
+	if fileStats, serr := os.Stat(rt.toFile); serr == nil {
+		rt.result.Size = fileStats.Size()
+	}
+	if err == nil && res != nil {
+		rt.normalizeResponse(res)
+	}
+	if err == nil {
+		// Complete, so there's nothing to resume
+		rt.removeCheckpoint()
+	}
+	if err == nil && rt.receiptPath != "" {
+		err = rt.writeReceipt()
+	}
+	rt.settle(err)
+	return err
+}
+
+// settle records “err“ as the outcome of the download, and signals that it has completed, closing the
+// WithThroughput and WithPlan chans, and the WithProgress and WithChunkProgress chans once the last chunk is done
+// with them.
+func (rt *RangeTripper) settle(err error) {
+	rt.finalErr = err
+
+	if rt.progress != nil || rt.chunkProg != nil {
+		// Chunks abandoned by an early return may still be reporting on their way out
+		go func() {
+			rt.wg.Wait()
+			if rt.progress != nil {
+				close(rt.progress)
+			}
+			if rt.chunkProg != nil {
+				close(rt.chunkProg)
+			}
+		}()
+	}
+	if rt.throughput != nil {
+		// The ticker sending to it has already stopped
+		close(rt.throughput)
+	}
+	if rt.plans != nil {
+		// Only ever sent to by RoundTrip itself
+		close(rt.plans)
+	}
+	close(rt.done)
+}
@@ -0,0 +1,191 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_Wait(t *testing.T) {
+
+	Convey("When RoundTrip is run in a goroutine, Wait blocks until it completes and summarizes the download", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("ETag", `"v1"`)
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtwait")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		go rt.RoundTrip(req)
+
+		result, werr := rt.Wait()
+		So(werr, ShouldBeNil)
+		So(result.URL, ShouldEqual, server.URL)
+		So(result.Size, ShouldEqual, len(serverBytes))
+		So(result.Ranged, ShouldBeTrue)
+		So(result.Chunks, ShouldEqual, 11)
+		So(result.ETag, ShouldEqual, `"v1"`)
+		So(result.Duration, ShouldBeGreaterThan, 0)
+
+		Convey("... and Wait can be called again after it has completed", func() {
+			result2, werr := rt.Wait()
+			So(werr, ShouldBeNil)
+			So(result2, ShouldResemble, result)
+		})
+	})
+}
+
+func Test_WaitStreamParts(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+	tfile, err := os.CreateTemp("/tmp", "rtwait")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	// waited returns what Wait does, or fails if it doesn't return promptly
+	waited := func(rt *RangeTripper) (DownloadResult, error) {
+		select {
+		case <-rt.Done():
+		case <-time.After(5 * time.Second):
+			So("Wait didn't return", ShouldBeEmpty)
+		}
+		return rt.Wait()
+	}
+
+	Convey("When Stream or WriteParts is used, Wait returns once it is done", t, func() {
+		for _, ranged := range []bool{true, false} {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if !ranged {
+					rw.Write(serverBytes) // Simple write
+					return
+				}
+				http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+			}))
+			defer server.Close()
+
+			rt, err := New(3, tfile.Name())
+			So(err, ShouldBeNil)
+
+			body, serr := rt.Stream(context.Background(), server.URL)
+			So(serr, ShouldBeNil)
+			streamed, rerr := io.ReadAll(body)
+			So(rerr, ShouldBeNil)
+			So(streamed, ShouldResemble, serverBytes)
+			body.Close()
+
+			result, werr := waited(rt)
+			So(werr, ShouldBeNil)
+			So(result.URL, ShouldEqual, server.URL)
+			So(result.Ranged, ShouldEqual, ranged)
+
+			rt, err = New(3, tfile.Name())
+			So(err, ShouldBeNil)
+
+			mp := &memoryParts{parts: make(map[int][]byte), spans: make(map[int]Range)}
+			_, perr := rt.WriteParts(context.Background(), server.URL, mp)
+			So(perr, ShouldBeNil)
+
+			result, werr = waited(rt)
+			So(werr, ShouldBeNil)
+			So(result.Ranged, ShouldEqual, ranged)
+		}
+	})
+
+	Convey("When Stream fails, Wait returns its error", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client)) // use a normal http.Client
+
+		_, serr := rt.Stream(context.Background(), server.URL)
+		So(serr, ShouldNotBeNil)
+
+		_, werr := waited(rt)
+		So(werr, ShouldEqual, serr)
+	})
+}
+
+func Test_DoneErr(t *testing.T) {
+
+	Convey("When several RangeTrippers are run concurrently, Done and Err report on each", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/forbidden" {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			rw.Write(serverBytes) // Simple write
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		good, err := os.CreateTemp("/tmp", "rtdone")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(good.Name())
+
+		bad, err := os.CreateTemp("/tmp", "rtdone")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(bad.Name())
+
+		goodRT, err := New(10, good.Name())
+		So(err, ShouldBeNil)
+		badRT, err := New(10, bad.Name())
+		So(err, ShouldBeNil)
+		badRT.SetClient(new(http.Client)) // use a normal http.Client
+
+		So(goodRT.Err(), ShouldBeNil)
+		select {
+		case <-goodRT.Done():
+			So("Done before RoundTrip", ShouldBeEmpty)
+		default:
+		}
+
+		go goodRT.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		go badRT.RoundTrip(httptest.NewRequest("GET", server.URL+"/forbidden", nil))
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-goodRT.Done():
+				So(goodRT.Err(), ShouldBeNil)
+			case <-badRT.Done():
+				So(badRT.Err(), ShouldNotBeNil)
+			}
+		}
+		<-goodRT.Done()
+		<-badRT.Done()
+	})
+}
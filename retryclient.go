@@ -1,11 +1,15 @@
 package rangetripper
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 
 	"github.com/eapache/go-resiliency/retrier"
 
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 )
@@ -16,55 +20,193 @@ var (
 
 // RetryClient contains variables and methods to use when making smarter HTTP requests
 type RetryClient struct {
-	client  *http.Client
-	timeout time.Duration
-	retrier *retrier.Retrier
+	client     *http.Client
+	timeout    time.Duration
+	retrier    *retrier.Retrier
+	backoff    []time.Duration
+	logger     *log.Logger
+	retriable  func(error) bool
+	idempotent bool
 }
 
-// NewRetryClient returns a RetryClient that will retry failed requests ``retries`` times, every ``every``,
-// and use ``timeout`` as a timeout
-func NewRetryClient(retries int, every, timeout time.Duration) *RetryClient {
+// DefaultErrorClassifier returns false for errors that retrying won't fix: non-retriable HTTP statuses, and
+// TLS certificate problems, including PinMismatchError. Everything else, e.g. connection resets and timeouts,
+// is worth another try.
+func DefaultErrorClassifier(err error) bool {
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
 
-	b := make(retrier.BlacklistClassifier, 1)
-	b[0] = errStatusNope
+	switch {
+	case errors.Is(err, errStatusNope), errors.Is(err, PinMismatchError):
+		return false
+	case errors.As(err, &verifyErr), errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return false
+	}
+	return true
+}
 
-	return &RetryClient{
-		client: &http.Client{
-			Timeout: timeout,
-		},
-		timeout: timeout,
-		retrier: retrier.New(retrier.ConstantBackoff(retries, every), b),
+// retryClassifier is a retrier.Classifier that defers to the RetryClient's error classifier
+type retryClassifier struct {
+	w *RetryClient
+}
+
+// Classify implements retrier.Classifier
+func (c retryClassifier) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	} else if c.w.retriable(err) {
+		return retrier.Retry
 	}
+	return retrier.Fail
+}
+
+// NewRetryClient returns a RetryClient that will retry failed requests ``retries`` times, every ``every``,
+// and use ``timeout`` as a timeout
+func NewRetryClient(retries int, every, timeout time.Duration) *RetryClient {
+	return newRetryClient(retrier.ConstantBackoff(retries, every), timeout)
 }
 
 // NewRetryClientWithExponentialBackoff returns a RetryClient that will retry failed requests ``retries`` times,
 // first after ``initially`` and exponentially longer each time, and use ``timeout`` as a timeout
 func NewRetryClientWithExponentialBackoff(retries int, initially, timeout time.Duration) *RetryClient {
-	b := make(retrier.BlacklistClassifier, 1)
-	b[0] = errStatusNope
+	return newRetryClient(retrier.ExponentialBackoff(retries, initially), timeout)
+}
 
-	return &RetryClient{
+// newRetryClient returns a RetryClient with the specified backoff and timeout, classifying errors with the
+// DefaultErrorClassifier
+func newRetryClient(backoff []time.Duration, timeout time.Duration) *RetryClient {
+	w := &RetryClient{
 		client: &http.Client{
 			Timeout: timeout,
 		},
-		timeout: timeout,
-		retrier: retrier.New(retrier.ExponentialBackoff(retries, initially), b),
+		timeout:   timeout,
+		backoff:   backoff,
+		retriable: DefaultErrorClassifier,
+	}
+	w.retrier = retrier.New(backoff, retryClassifier{w})
+	return w
+}
+
+// SetErrorClassifier sets the function that decides whether a failed attempt should be retried, given its
+// error, which may be from the transport or due to the HTTP status. If nil, DefaultErrorClassifier is used.
+// Wrapping DefaultErrorClassifier is a good way to add to it.
+func (w *RetryClient) SetErrorClassifier(retriable func(err error) bool) {
+	if retriable == nil {
+		retriable = DefaultErrorClassifier
+	}
+	w.retriable = retriable
+}
+
+// SetIdempotent, if true, retries requests whatever their method. By default, only GET, HEAD, OPTIONS, and TRACE
+// requests, or those with an Idempotency-Key (or X-Idempotency-Key) header, are retried, so that a request with
+// side effects, e.g. a POST, is never made twice by accident. Either way, a request with a Body is only retried
+// if it has a GetBody to get the Body again, as http.NewRequest provides for the usual readers.
+func (w *RetryClient) SetIdempotent(idempotent bool) {
+	w.idempotent = idempotent
+}
+
+// replayable returns true if the Request may be sent again after a failed attempt
+func (w *RetryClient) replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	} else if w.idempotent {
+		return true
 	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
 }
 
-// Do takes a Request, and returns a Response or an error, following the rules of the RetryClient
+// SetLogger sets a Logger to send the outcome of each failed attempt to, along with how many attempts
+// remain and how long until the next one. If nil, nothing is logged.
+func (w *RetryClient) SetLogger(logger *log.Logger) {
+	w.logger = logger
+}
+
+// logAttempt logs the outcome of a failed attempt, if there is a logger
+func (w *RetryClient) logAttempt(req *http.Request, attempt int, err error) {
+	if w.logger == nil {
+		return
+	}
+
+	total := len(w.backoff) + 1
+	if !w.retriable(err) || !w.replayable(req) {
+		w.logger.Printf("%s %s attempt %d/%d failed: %v, not retrying\n", req.Method, req.URL, attempt, total, err)
+	} else if attempt < total {
+		w.logger.Printf("%s %s attempt %d/%d failed: %v, retrying in %s\n", req.Method, req.URL, attempt, total, err, w.backoff[attempt-1])
+	} else {
+		w.logger.Printf("%s %s attempt %d/%d failed: %v, giving up\n", req.Method, req.URL, attempt, total, err)
+	}
+}
+
+// RetryStats is how a RetryClient went about a request
+type RetryStats struct {
+	// Attempts is the number of attempts made, including the first
+	Attempts int
+	// Elapsed is the time spent on all of them, including backoff between them
+	Elapsed time.Duration
+	// StatusCode is the status of the last response received, if any, e.g. the one that wasn't worth retrying
+	StatusCode int
+}
+
+// Do takes a Request, and returns a Response or an error, following the rules of the RetryClient.
+// If the Request's context is cancelled, no further attempts are made, and any pending backoff is abandoned.
 func (w *RetryClient) Do(req *http.Request) (*http.Response, error) {
-	var ret *http.Response
+	res, _, err := w.DoWithStats(req)
+	return res, err
+}
+
+// DoWithStats is Do, also returning the RetryStats of the request, whether it succeeded or not, so the time
+// spent retrying can be told apart from the time spent transferring.
+func (w *RetryClient) DoWithStats(req *http.Request) (*http.Response, RetryStats, error) {
+	var (
+		ret     *http.Response
+		attempt int
+		status  int
+		start   = time.Now()
+	)
 
-	try := func() error {
-		resp, tryErr := w.client.Do(req)
+	try := func(ctx context.Context) (tryErr error) {
+		attempt++
+		if attempt > 1 {
+			countRetry(req.Context())
+		}
+		defer func() {
+			if tryErr != nil {
+				w.logAttempt(req, attempt, tryErr)
+			}
+		}()
+
+		r := req.WithContext(ctx)
+		if attempt > 1 && req.GetBody != nil {
+			// The last attempt read it
+			if r.Body, tryErr = req.GetBody(); tryErr != nil {
+				return tryErr
+			}
+		}
+
+		resp, tryErr := w.client.Do(r)
 		if tryErr != nil {
 			return tryErr
 		}
+		status = resp.StatusCode
 
 		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			resp.Body.Close()
 			return errStatusNope
+		} else if resp.StatusCode == http.StatusNotModified {
+			// Only ever the answer to a conditional request, and a fine one
+			ret = resp
+			return nil
 		} else if resp.StatusCode >= 300 || resp.StatusCode < 200 {
+			resp.Body.Close()
 			return fmt.Errorf("non 2XX HTTP status received: %s", resp.Status)
 		}
 
@@ -72,8 +214,15 @@ func (w *RetryClient) Do(req *http.Request) (*http.Response, error) {
 		return nil
 	}
 
-	if err := w.retrier.Run(try); err != nil {
-		return nil, err
+	var err error
+	if w.replayable(req) {
+		err = w.retrier.RunCtx(req.Context(), try)
+	} else {
+		err = try(req.Context())
+	}
+	stats := RetryStats{Attempts: attempt, Elapsed: time.Since(start), StatusCode: status}
+	if err != nil {
+		return nil, stats, err
 	}
-	return ret, nil
+	return ret, stats, nil
 }
@@ -10,11 +10,18 @@ import (
 	"github.com/cognusion/semaphore"
 	"go.uber.org/atomic"
 
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -24,16 +31,36 @@ import (
 // Static errors to return
 const (
 	ContentLengthNumericError   = rtError("Content-Length value cannot be converted to a number")
-	ContentLengthMismatchError  = rtError("downloaded file size does not match content-length")
 	SingleRequestExhaustedError = rtError("one request has already been made with this RangeTripper")
+	UnknownSizeError            = rtError("size of the content is unknown, so it cannot be downloaded in chunks")
+	RangesUnsupportedError      = rtError("server does not support byte ranges")
+	RangeOverrunError           = rtError("server sent more than the requested range")
+	FirstByteTimeoutError       = rtError("server did not respond within the first byte timeout")
+	FileShrankError             = rtError("remote file is smaller than when the download started")
+	ValidationError             = rtError("content failed validation")
+	CompressedRangeError        = rtError("server compressed a range, so the content cannot be downloaded in chunks")
+	RangeMisplacedError         = rtError("server sent a range starting somewhere other than requested")
 
 	headFakeFailedError = rtError("headfake failed, return previous error")
 )
 
 var (
 	seq = sequence.New(0)
+
+	// chunkBuffers are reused to read chunks into before they are written
+	chunkBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
 )
 
+// DefaultChunkRetries is the number of times a chunk is retried after exceeding its deadline, unless
+// SetChunkRetries is used.
+const DefaultChunkRetries = 3
+
+// maxDrainBytes is the most we'll read from an unwanted Response Body to keep its connection alive.
+const maxDrainBytes = 64 * 1024
+
+// maxPooledBuffer is the largest chunk buffer put back in chunkBuffers, so one huge chunk doesn't pin its memory.
+const maxPooledBuffer = 1 << 20
+
 // RTError is an error type
 type rtError string
 
@@ -42,24 +69,225 @@ func (e rtError) Error() string {
 	return string(e)
 }
 
+// ContentLengthMismatchError is returned, wrapped, when the downloaded file isn't the size the server said it
+// would be. Use errors.As to get at the sizes, or errors.Is with a zero ContentLengthMismatchError to match
+// any mismatch.
+type ContentLengthMismatchError struct {
+	// Expected is the size the server said the content was
+	Expected int64
+	// Actual is the size of the file that was written
+	Actual int64
+}
+
+// Error returns the stringified version of ContentLengthMismatchError
+func (e ContentLengthMismatchError) Error() string {
+	return fmt.Sprintf("downloaded file size does not match content-length: actual size %d, expected size %d", e.Actual, e.Expected)
+}
+
+// Is returns true if “target“ is a ContentLengthMismatchError with the same sizes, or is a zero
+// ContentLengthMismatchError, which matches any sizes.
+func (e ContentLengthMismatchError) Is(target error) bool {
+	var t ContentLengthMismatchError
+	switch v := target.(type) {
+	case ContentLengthMismatchError:
+		t = v
+	case *ContentLengthMismatchError:
+		if v == nil {
+			return false
+		}
+		t = *v
+	default:
+		return false
+	}
+	return t == ContentLengthMismatchError{} || t == e
+}
+
+// InvalidContentLengthError is returned, perhaps wrapped, when a server sends a Content-Length that isn't a
+// number. It wraps ContentLengthNumericError, so errors.Is still matches that.
+type InvalidContentLengthError struct {
+	// URL is where the response came from, after any redirects
+	URL string
+	// Value is the Content-Length that was sent
+	Value string
+}
+
+// Error returns the stringified version of InvalidContentLengthError
+func (e InvalidContentLengthError) Error() string {
+	return fmt.Sprintf("value of Content-Length header from %s appears non-numeric: '%s': %s", e.URL, e.Value, ContentLengthNumericError)
+}
+
+// Unwrap returns ContentLengthNumericError
+func (e InvalidContentLengthError) Unwrap() error {
+	return ContentLengthNumericError
+}
+
+// InvalidURLError is returned by RoundTrip when the Request's URL can't be downloaded from
+type InvalidURLError struct {
+	// URL is the URL of the Request
+	URL string
+	// Reason is what's wrong with it
+	Reason string
+}
+
+// Error returns the stringified version of InvalidURLError
+func (e InvalidURLError) Error() string {
+	return fmt.Sprintf("invalid URL '%s': %s", e.URL, e.Reason)
+}
+
+// checkURL returns an InvalidURLError if “u“ isn't an absolute http or https URL with a host.
+func checkURL(u *url.URL) error {
+	switch {
+	case u == nil:
+		return InvalidURLError{Reason: "no URL"}
+	case u.Scheme == "":
+		return InvalidURLError{URL: u.String(), Reason: "no scheme"}
+	case !strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https"):
+		return InvalidURLError{URL: u.String(), Reason: fmt.Sprintf("unsupported scheme '%s'", u.Scheme)}
+	case u.Host == "":
+		return InvalidURLError{URL: u.String(), Reason: "no host"}
+	}
+	return nil
+}
+
 // RangeTripper is an http.RoundTripper to be used in an http.Client.
 // This should not be used in its default state, instead by its New functions.
-// A single RangeTripper *must* only be used for one request.
+// A single RangeTripper *must* only be used for one request, unless each Request says where its own output
+// goes with WithOutputFile, in which case the RangeTripper can be shared by any number of them, concurrently.
 type RangeTripper struct {
+	*download
+
 	TimingsOut *log.Logger
 	DebugOut   *log.Logger
 
 	client     Client
+	chain      []func(http.RoundTripper) http.RoundTripper
 	workers    int
+	maxWorkers int
 	toFile     string
-	outFile    *os.File
-	wg         sync.WaitGroup
-	checkLock  sync.Mutex
-	sem        semaphore.Semaphore
-	progress   chan int64
-	used       bool
-	fetchError atomic.Error
+	baseDir    string
 	chunkSize  int64
+	maxChunks  int
+	workersMin int
+	workersMax int
+	knownSize  int64
+	maxLength  int64
+	threshold  int64
+	inFlight   *byteBudget
+	fileMode   os.FileMode
+	fileFlags  int
+	keepMtime  bool
+	fileBody   bool
+	onFallback func(string)
+	reqRanges  bool
+	dlid       string
+	rangeCache RangeSupportCache
+	perCall    bool
+
+	chunkDeadline time.Duration
+	timeout       time.Duration
+	opCtx         context.Context
+	chunkRetries  int
+	firstByte     time.Duration
+	writeOffset   int64
+
+	headFakeRetries int
+	minimalProbe    bool
+	assumeRanges    bool
+	shrinkRestarts  int
+	mismatchRetries int
+
+	bodyValidator func(*http.Response) error
+	postVerify    func(string) error
+	receiptPath   string
+	verifyDigest  bool
+	resume        bool
+
+	writeBufferSize int
+	granularity     int64
+	restartOnChange bool
+	scheduler       func(int64, int) []Range
+	chunkPlanner    func(*http.Response) (int, int64)
+	shuffle         bool
+	shuffleSeed     int64
+	seeded          bool
+	pieces          []Range
+	pieceHashes     map[Range][]byte
+	pieceErr        error
+	reorderBytes    int64
+	pendingWrites   *semaphore.Semaphore
+	mirrors         []string
+	refresher       func(string) (string, error)
+	ranges          []Range
+
+	progressEvery time.Duration
+	progressFunc  func(float64, int64)
+
+	progressJSON      io.Writer
+	progressJSONEvery time.Duration
+}
+
+// download is the state of a single download, kept apart from the settings of the RangeTripper running it,
+// so a RangeTripper shared via WithOutputFile can give each Request its own.
+type download struct {
+	planned   int
+	outFile   *os.File
+	wg        sync.WaitGroup
+	checkLock sync.Mutex
+	sem       semaphore.Semaphore
+	progress  chan int64
+	chunkProg chan ChunkProgress
+	plans     chan PlanEvent
+	used      bool
+
+	fetchError atomic.Error
+	requests   atomic.Int64
+	rangesOK   bool
+	resumeFrom int64
+	ifRange    string
+	shuffler   *rand.Rand
+
+	chainLock sync.Mutex
+	chained   http.RoundTripper
+
+	refreshLock   sync.Mutex
+	refreshed     map[string]string
+	reportedTotal chan int64
+	totalReported atomic.Bool
+	totalsLock    sync.Mutex
+	totals        map[int64]bool
+
+	done     chan struct{}
+	result   DownloadResult
+	finalErr error
+
+	stopping      atomic.Bool
+	abandon       chan struct{}
+	abandonOnce   sync.Once
+	completedLock sync.Mutex
+	completed     []Range
+	reusing       bool
+	reuseFrom     int64
+
+	traceLock  sync.Mutex
+	trace      []TraceEntry
+	ttfbs      []time.Duration
+	connNew    atomic.Int64
+	connReused atomic.Int64
+
+	received   atomic.Int64
+	expected   atomic.Int64
+	sentTotal  bool
+	sentBytes  atomic.Int64
+	throughput chan ThroughputSample
+}
+
+// newDownload returns the state for a download run by up to “maxWorkers“ workers at once
+func newDownload(maxWorkers int) *download {
+	return &download{
+		done:    make(chan struct{}),
+		abandon: make(chan struct{}),
+		sem:     semaphore.NewSemaphore(maxWorkers),
+	}
 }
 
 // New simply returns a RangeTripper or an error. Logged messages are discarded.
@@ -69,10 +297,11 @@ func New(fileChunks int, outputFilePath string) (*RangeTripper, error) {
 
 // NewWithLoggers returns a RangeTripper or an error. Logged messages are sent to the specified Logger, or discarded if nil.
 func NewWithLoggers(fileChunks int, outputFilePath string, timingLogger, debugLogger *log.Logger) (*RangeTripper, error) {
-	// Validate file to write to, early
-	outFile, err := os.Create(outputFilePath)
-	if err != nil {
+	// Validate directory to write to, early. The file itself is opened by RoundTrip.
+	if dirStats, err := os.Stat(filepath.Dir(outputFilePath)); err != nil {
 		return nil, err
+	} else if !dirStats.IsDir() {
+		return nil, fmt.Errorf("'%s' is not a directory", filepath.Dir(outputFilePath))
 	}
 
 	// sanity
@@ -95,25 +324,34 @@ func NewWithLoggers(fileChunks int, outputFilePath string, timingLogger, debugLo
 		DebugOut:   debugLogger,
 		workers:    fileChunks,
 		toFile:     outputFilePath,
-		outFile:    outFile,
-		client:     DefaultClient,
-		sem:        semaphore.NewSemaphore(fileChunks + 1),
+		client:     defaultClient(),
+		maxWorkers: fileChunks + 1,
+		maxChunks:  DefaultMaxChunks,
+		download:   newDownload(fileChunks + 1),
+
+		chunkRetries: DefaultChunkRetries,
 	}, nil
 }
 
 // SetClient allows for overriding the Client used to make the requests.
 func (rt *RangeTripper) SetClient(client Client) {
 	rt.client = client
+
+	rt.chainLock.Lock()
+	defer rt.chainLock.Unlock()
+	rt.chained = nil
 }
 
-// SetMax allows for setting the maximum number of concurrently-running workers
+// SetMax sets the maximum number of concurrently-running workers, and nothing else: the number of chunks is
+// still determined by “fileChunks“ or SetChunkSize. Fewer workers than chunks means chunks queue for a worker,
+// more simply means no chunk waits. Values less than 1 are ignored. The default is “fileChunks“+1, to cover
+// any gap chunk.
 func (rt *RangeTripper) SetMax(max int) {
-	if max == 0 {
+	if max < 1 {
 		return
-	} else if max > rt.workers {
-		max = rt.workers + 1
 	}
 
+	rt.maxWorkers = max
 	rt.sem = semaphore.NewSemaphore(max)
 }
 
@@ -128,9 +366,236 @@ func (rt *RangeTripper) SetChunkSize(chunkBytes int64) {
 	rt.chunkSize = chunkBytes
 }
 
-// WithProgress returns a read-only chan that will first provide the total length of the content (in bytes),
-// followed by a stream of completed byte-lengths. CAUTION: It is a generally bad idea to call this and then
-// ignore the resulting channel.
+// SetChunkDeadline sets a hard ceiling on how long any one attempt to download a chunk may take. An attempt that
+// hasn't completed in time is cancelled, its partial bytes are discarded, and the chunk is retried from scratch
+// on a fresh connection, up to the limit set by SetChunkRetries. This is independent of the Client's timeout,
+// which may be generous for big chunks, and is meant to catch wedged transfers. 0 disables the deadline.
+func (rt *RangeTripper) SetChunkDeadline(d time.Duration) {
+	rt.chunkDeadline = d
+}
+
+// SetFirstByteTimeout sets how long any one attempt to download a chunk may wait for the server to start
+// responding. An attempt that hasn't received the response headers in time is cancelled and retried, up to
+// the limit set by SetChunkRetries, so a connection that was accepted but never answered is noticed long
+// before the chunk deadline or the Client's timeout. 0 disables the timeout.
+func (rt *RangeTripper) SetFirstByteTimeout(d time.Duration) {
+	rt.firstByte = d
+}
+
+// SetChunkRetries sets the number of times a chunk is retried after exceeding its deadline or first byte
+// timeout, or not matching its Piece hash (see SetPieceManifest). The default is DefaultChunkRetries.
+func (rt *RangeTripper) SetChunkRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.chunkRetries = n
+}
+
+// SetHeadFakeRetries sets the number of times the ranged GET used in place of a failed or forbidden HEAD is
+// retried if it errors or gets a 5xx, before giving up on it. The default is 0. This is independent of
+// SetChunkRetries, and of any retrying the Client does itself.
+func (rt *RangeTripper) SetHeadFakeRetries(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.headFakeRetries = n
+}
+
+// SetAssumeRanges sets whether to try a ranged GET when the probe doesn't say that ranges are supported, as
+// plenty of servers support them without sending Accept-Ranges. If the server answers with a 206, the content
+// is downloaded in chunks, and if it answers with a 200, the whole content is taken from that. A server that
+// sends “Accept-Ranges: none“ is taken at its word. It is off by default.
+func (rt *RangeTripper) SetAssumeRanges(assume bool) {
+	rt.assumeRanges = assume
+}
+
+// SetMinimalProbe sets whether the ranged GET used in place of a failed or forbidden HEAD asks for only the first
+// byte, instead of the first 11, and is closed without reading any of it, to keep the probe as cheap as
+// possible on metered origins. It is off by default, as some servers reject a range of a single byte.
+func (rt *RangeTripper) SetMinimalProbe(minimal bool) {
+	rt.minimalProbe = minimal
+}
+
+// SetShrinkRestarts sets the number of times a download is started over, from a fresh probe, if the remote
+// file turns out to be smaller than planned for, e.g. because it is being rewritten. The default is 0, so a
+// shrinking file fails the download with a wrapped FileShrankError.
+func (rt *RangeTripper) SetShrinkRestarts(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.shrinkRestarts = n
+}
+
+// SetDownloadID sets the ID that identifies the download in debug and timing messages, e.g. a trace ID, so
+// they can be correlated with other logs. By default a new ID is generated for each download. An ID set in
+// the Request's context with WithDownloadID takes precedence.
+func (rt *RangeTripper) SetDownloadID(id string) {
+	rt.dlid = id
+}
+
+// SetFileMode sets the permissions of the output file, regardless of the umask. By default the file is
+// created with 0666, before the umask.
+func (rt *RangeTripper) SetFileMode(mode os.FileMode) {
+	rt.fileMode = mode
+}
+
+// SetFileFlags sets additional flags to open the output file with, which is always opened with os.O_RDWR
+// and os.O_CREATE. os.O_EXCL is useful to avoid clobbering an existing file. os.O_APPEND is not supported.
+func (rt *RangeTripper) SetFileFlags(flags int) {
+	rt.fileFlags = flags &^ os.O_APPEND
+}
+
+// SetFileBody, if true, makes the Response returned by RoundTrip a 200 whose Body is the output file, opened
+// read-only, so it can be read like the Body of any other Response. The caller must Close it. Otherwise the
+// Response is whatever was used to probe the content, and its Body is closed.
+func (rt *RangeTripper) SetFileBody(fileBody bool) {
+	rt.fileBody = fileBody
+}
+
+// SetPreserveModTime, if true, sets the modification time of the output file to the Last-Modified time of the
+// content after a successful download. If the server doesn't provide a Last-Modified, the file is left alone.
+func (rt *RangeTripper) SetPreserveModTime(preserve bool) {
+	rt.keepMtime = preserve
+}
+
+// SetRequireRanges, if true, makes RoundTrip return an error rather than falling back to a single GET when the
+// content can't be downloaded in chunks: UnknownSizeError if its size can't be determined (see SetKnownSize),
+// or RangesUnsupportedError if the server doesn't support ranges. SetParallelThreshold is ignored.
+func (rt *RangeTripper) SetRequireRanges(require bool) {
+	rt.reqRanges = require
+}
+
+// SetOnFallback sets a function that is called with the reason whenever RoundTrip downloads the content with a
+// single GET rather than in chunks, e.g. because the server doesn't support ranges, or didn't say how big the
+// content is.
+func (rt *RangeTripper) SetOnFallback(onFallback func(reason string)) {
+	rt.onFallback = onFallback
+}
+
+// SetKnownSize tells RangeTripper the size of the content, e.g. from a manifest, so chunks can be planned
+// even if the server doesn't provide a Content-Length. The size is authoritative: it is used instead of any
+// Content-Length, and the downloaded file is verified against it. The server must still support ranges.
+func (rt *RangeTripper) SetKnownSize(n int64) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.knownSize = n
+}
+
+// SetParallelThreshold sets the smallest Content-Length that will be downloaded in chunks. Anything smaller is
+// downloaded with a single GET, even if the server supports ranges, as the extra requests would cost more than
+// the parallelism saves. The default of 0 always downloads in chunks when possible.
+func (rt *RangeTripper) SetParallelThreshold(n int64) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.threshold = n
+}
+
+// SetMaxChunks sets the most chunks a download will be divided into when SetChunkSize is used. If the
+// Content-Length divided by the chunk size would exceed this, the chunk size is raised to compensate.
+// The default is DefaultMaxChunks. 0 removes the limit, which is unwise.
+func (rt *RangeTripper) SetMaxChunks(max int) {
+	if max < 0 {
+		max = 0
+	}
+
+	rt.maxChunks = max
+}
+
+// SetWorkerBounds sets the fewest and most workers a download will be divided into when SetChunkSize is used,
+// so it suits content of any size: the chunk size is lowered so small content still gets at least “min“
+// workers, or raised so large content gets no more than “max“, along with SetMaxChunks. Content with fewer
+// bytes than “min“ gets a worker per byte. Values less than 1 remove that bound, and a “max“ below “min“ is
+// raised to it.
+func (rt *RangeTripper) SetWorkerBounds(min, max int) {
+	if min < 0 {
+		min = 0
+	}
+	if max < 0 {
+		max = 0
+	} else if max > 0 && max < min {
+		max = min
+	}
+
+	rt.workersMin = min
+	rt.workersMax = max
+}
+
+// SetMaxInFlightBytes caps the total number of bytes being actively transferred at once, independent of
+// the number of workers. Each worker must acquire its chunk's length from this budget before starting, and
+// releases it after writing. A chunk larger than the cap will consume the whole budget. 0 disables the cap.
+func (rt *RangeTripper) SetMaxInFlightBytes(n int64) {
+	if n < 1 {
+		rt.inFlight = nil
+		return
+	}
+
+	rt.inFlight = newByteBudget(n)
+}
+
+// SetBodyValidator sets a function that is run against the probe response (from the HEAD, or the ranged GET
+// used when the HEAD fails) before any download is committed to. The Body of a HEAD response will be empty,
+// but a ranged GET will have the first few bytes available to sniff. If the function returns an error, RoundTrip
+// returns that error, wrapped along with ValidationError, without downloading anything further.
+func (rt *RangeTripper) SetBodyValidator(validator func(head *http.Response) error) {
+	rt.bodyValidator = validator
+}
+
+// SetPostVerify sets a function that is called with the path of the output file once it has been completely
+// downloaded and its size checked, to validate its content with whatever domain logic is appropriate. If it
+// returns an error, RoundTrip returns it, wrapped along with ValidationError.
+func (rt *RangeTripper) SetPostVerify(verify func(path string) error) {
+	rt.postVerify = verify
+}
+
+// SetResumeFromFileSize, if true, will trust the size of an existing output file as the completed prefix of the
+// download, and only fetch the remaining bytes. If the Request has an “If-Range“ header, it must match the ETag
+// of the remote file, or the download starts over. The download also starts over if ranges aren't supported, or if
+// the existing file is larger than the remote one. If Shutdown left a checkpoint of the download, the chunks it
+// recorded are kept instead, whatever the size of the file, so long as it is for content of the same size and ETag.
+func (rt *RangeTripper) SetResumeFromFileSize(resume bool) {
+	rt.resume = resume
+}
+
+// SetWriteBufferSize, if greater than 0, streams each chunk to the output file through a buffer of this many bytes,
+// flushed when the chunk completes, instead of reading the whole chunk into memory and writing it at once.
+func (rt *RangeTripper) SetWriteBufferSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.writeBufferSize = n
+}
+
+// SetPendingWriteLimit, if greater than 0, limits the number of chunks being written to the output file at once.
+// Workers read their chunk into memory, or with SetWriteBufferSize, each bufferful of it, and then wait for a
+// write slot, so when the disk is slower than the network, writes queue for it rather than all contending at once.
+// Reads are never held up by it.
+func (rt *RangeTripper) SetPendingWriteLimit(n int) {
+	if n < 1 {
+		rt.pendingWrites = nil
+		return
+	}
+
+	s := semaphore.NewSemaphore(n)
+	rt.pendingWrites = &s
+}
+
+// WithProgress returns a read-only chan that will first provide the total length of the content (in bytes), or
+// -1 if it isn't known, followed by a stream of completed byte-lengths: one per chunk, or a run of them as the
+// content arrives if it is downloaded in one go. The chan belongs to the RangeTripper, which closes it once
+// RoundTrip has returned and every chunk has finished, whether or not the total was ever sent, and being
+// read-only, the caller can't close it, so sends to it can't panic. If bytes already sent are discarded, e.g. by a
+// restart (see SetShrinkRestarts), a negative byte-length takes them back, so what has been sent always adds up
+// to what has been kept. See ProgressAccumulator for a ready-made consumer. CAUTION: It is a generally bad idea
+// to call this and then ignore the resulting channel, as once its buffer is full, the download waits for it to
+// be read.
 func (rt *RangeTripper) WithProgress() <-chan int64 {
 	if rt.progress == nil {
 		rt.progress = make(chan int64, 100)
@@ -138,16 +603,52 @@ func (rt *RangeTripper) WithProgress() <-chan int64 {
 	return rt.progress
 }
 
+// ChunkProgress is an update on the progress of one chunk. Start and End are the half-open byte offsets of the
+// chunk in the output file, and BytesDone is how much of it has been written. Once it has been, TTFB is how long
+// the origin took to start responding to the request for it, and Duration is how long the chunk took in all, so
+// a slow origin can be told from a slow connection.
+type ChunkProgress struct {
+	Start     int64
+	End       int64
+	BytesDone int64
+	TTFB      time.Duration
+	Duration  time.Duration
+}
+
+// WithChunkProgress returns a read-only chan that will provide a ChunkProgress when each chunk is started, with
+// a BytesDone of 0, and another when it has been written, with a BytesDone of its length. Chunks that fail get
+// no second update. Combined with the total length from WithProgress, this is enough to draw which parts of
+// the file are done. The chan belongs to the RangeTripper, which closes it once RoundTrip has returned and every
+// chunk has finished, so it can be ranged over. CAUTION: It is a generally bad idea to call this and then ignore
+// the resulting channel, as once its buffer is full, the download waits for it to be read.
+func (rt *RangeTripper) WithChunkProgress() <-chan ChunkProgress {
+	if rt.chunkProg == nil {
+		rt.chunkProg = make(chan ChunkProgress, 100)
+	}
+	return rt.chunkProg
+}
+
 // RoundTrip is called with a formed Request, writing the Body of the Response to
-// to the specified output file. The Response should be ignored, but
-// errors are important. Both the Request.Body and the RangeTripper.outFile will be
-// closed when this function returns.
+// to the specified output file. The Response should be ignored (see SetFileBody), but
+// errors are important. The output file is opened (see SetFileMode and SetFileFlags)
+// when this function is called. Both the Request.Body and the output file will be
+// closed when this function returns. Loggers set in the Request's context via
+// WithDebugLogger or WithTimingsLogger are used instead of DebugOut and TimingsOut.
+// However the content was probed and downloaded, a successful Response is a 200 with
+// the size of the output file as its Content-Length, an Accept-Ranges of "bytes" or
+// "none", and the RangedHeader and ChunksHeader. If the Request's context has a path
+// from WithOutputFile, the content is written there instead, as a download of its own.
 func (rt *RangeTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if path, ok := r.Context().Value(outputFileKey).(string); ok && !rt.perCall {
+		return rt.forCall(path).RoundTrip(r)
+	} else if l := rt.withLoggers(r.Context()); l != rt {
+		return l.RoundTrip(r)
+	}
+
 	// We only allow one execution total, which is gated by the rt.used flag,
 	// but to prevent races, we wrap it in a mutex to ensure proper control
 	rt.checkLock.Lock()
 	defer rt.checkLock.Unlock()
-	defer rt.outFile.Close()
 	if r.Body != nil {
 		defer r.Body.Close()
 	}
@@ -157,17 +658,132 @@ func (rt *RangeTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 	}
 	rt.used = true
 
+	start := time.Now()
+	if err := checkURL(r.URL); err != nil {
+		// Before anything else can trip over it
+		return nil, rt.finish(r, nil, err, start)
+	} else if rt.stopping.Load() {
+		return nil, rt.finish(r, nil, ShutdownError, start)
+	}
+	// Opened once, however many times the download is run, so restarts aren't tripped up by SetFileFlags
+	if err := rt.openOutput(); err != nil {
+		return nil, rt.finish(r, nil, err, start)
+	}
+	defer rt.outFile.Close()
+	caller := r.Context()
+	r, release := rt.abandonable(r)
+	defer release()
+	r, untime := rt.withTimeout(r)
+	defer untime()
+
+	stopProgress := rt.startProgressTicker()
+	res, err := rt.roundTrip(r)
+	for i := 0; i < rt.shrinkRestarts && errors.Is(err, FileShrankError) && r.Context().Err() == nil; i++ {
+		rt.DebugOut.Printf("Restarting download %d/%d: %v\n", i+1, rt.shrinkRestarts, err)
+		if err = rt.restart(); err == nil {
+			res, err = rt.roundTrip(r)
+		}
+	}
+	if errors.Is(err, ResourceChangedError) && rt.restartOnChange && r.Context().Err() == nil {
+		rt.DebugOut.Printf("Restarting download: %v\n", err)
+		if err = rt.restart(); err == nil {
+			res, err = rt.roundTrip(withoutIfRange(r))
+		}
+	}
+	for i := 0; i < rt.mismatchRetries && isMismatch(err) && r.Context().Err() == nil; i++ {
+		rt.DebugOut.Printf("Retrying incomplete download %d/%d: %v\n", i+1, rt.mismatchRetries, err)
+		rt.retryIncomplete()
+		res, err = rt.roundTrip(r)
+	}
+	stopProgress()
+	// The probe is bounded by its own context with the same deadline, which may be the first to expire
+	timedOut := errors.Is(r.Context().Err(), context.DeadlineExceeded) || errors.Is(rt.opContext().Err(), context.DeadlineExceeded)
+	if err != nil && rt.timeout > 0 && timedOut && caller.Err() == nil {
+		err = fmt.Errorf("download did not complete within %s: %w", rt.timeout, context.DeadlineExceeded)
+	}
+	var noDigest error
+	if err == nil && rt.verifyDigest {
+		if err = rt.verifyDigestHeader(res); errors.Is(err, NoDigestHeaderError) {
+			// Not a failure, so carry on, and report it at the end
+			noDigest, err = err, nil
+		}
+	}
+	if err == nil && rt.postVerify != nil {
+		if verr := rt.postVerify(rt.toFile); verr != nil {
+			err = fmt.Errorf("post-verification of %s failed: %w: %w", rt.toFile, ValidationError, verr)
+		}
+	}
+	if err == nil && rt.keepMtime {
+		err = rt.applyModTime(res)
+	}
+	if err == nil && rt.fileBody {
+		err = rt.setFileBody(res)
+	}
+	if err == nil {
+		err = noDigest
+	}
+	err = rt.finish(r, res, err, start)
+	return res, err
+}
+
+// restart waits for any outstanding chunks, and clears the way for roundTrip to be run again from scratch.
+func (rt *RangeTripper) restart() error {
+	rt.wg.Wait()
+	rt.fetchError.Store(nil)
+	rt.reportedTotal = nil
+	rt.resetTotals()
+	rt.settleProgress(0)
+	rt.completedLock.Lock()
+	rt.completed = nil
+	rt.completedLock.Unlock()
+	rt.reusing = false
+	return rt.resetOutput()
+}
+
+// roundTrip is the guts of RoundTrip, run once, unless the file shrinks (see SetShrinkRestarts) or changes (see
+// SetRestartOnChange).
+func (rt *RangeTripper) roundTrip(r *http.Request) (*http.Response, error) {
+	rt.rangesOK = false
+
+	if rt.reusing {
+		// POST: what the last attempt completed is kept (see SetRetryOnMismatch)
+	} else if rt.resume && rt.writeOffset == 0 {
+		fileStats, err := rt.outFile.Stat()
+		if err != nil {
+			return nil, err
+		}
+		rt.resumeFrom = fileStats.Size()
+	} else if err := rt.resetOutput(); err != nil {
+		return nil, err
+	}
+
 	var (
 		hres          *http.Response
 		err           error
-		contentLength int
-		dlid          = seq.NextHashID()
+		contentLength int64
+		dlid          = rt.downloadID(r.Context())
 	)
 
 	defer timings.Track(fmt.Sprintf("[%s] RangeTripper Full", dlid), time.Now(), rt.TimingsOut)
 
+	// A host known to support ranges can skip the HEAD
+	if rt.knownRanges(r.URL.Host) {
+		if hres, err = rt.tryHeadFake(r.URL.String()); err != nil {
+			// Not so known after all. Carry on as if we didn't know.
+			rt.DebugOut.Printf("[%s] Cached range support for %s didn't hold: %v\n", dlid, r.URL.Host, err)
+			hres = nil
+		} else if hres.StatusCode == http.StatusOK {
+			// It gave us the whole file, so we are done, and the cache was wrong
+			rt.rangeCache.Set(r.URL.Host, false)
+			rt.fallback(dlid, "cached range support, but a ranged GET returned the whole content")
+			return hres, nil
+		}
+	}
+
 	// Error on head: Bail?
-	if hres, err = rt.head(r.URL.String()); err != nil {
+	if hres != nil {
+		// POST: the cached probe already did the job
+	} else if hres, err = rt.head(rt.opContext(), r.URL.String()); err != nil {
 		// Some systems toss odd errors on HEAD requests. Noted against a PHP downloader that takes parameters.
 		hresn, errn := rt.tryHeadFake(r.URL.String())
 		if errn != nil {
@@ -175,15 +791,16 @@ func (rt *RangeTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 			return nil, err
 		} else if hresn.StatusCode == http.StatusOK {
 			// 200 means it didn't accept the range, and gave us the whole file, so we are done.
+			rt.fallback(dlid, "HEAD failed, and a ranged GET returned the whole content")
 			return hresn, nil
 		}
 		// POST: headfake worked, and we can GET using ranges
 		// silently replace the body
 		hres = hresn
 	}
-	hres.Body.Close()
 
 	if hres.StatusCode == http.StatusForbidden {
+		hres.Body.Close()
 		// Forbidden might just be for the HEAD
 		hfres, hferr := rt.tryHeadFake(r.URL.String())
 		if hferr == headFakeFailedError {
@@ -195,75 +812,260 @@ func (rt *RangeTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 			return nil, fmt.Errorf("error during HEAD: %d / %s", hres.StatusCode, hres.Status)
 		} else if hfres.StatusCode == http.StatusOK {
 			// 200 means it didn't accept the range, and gave us the whole file
+			rt.fallback(dlid, "HEAD forbidden, and a ranged GET returned the whole content")
 			return hfres, nil
 		}
 		// POST: headfake worked, and we can GET using ranges
 		// silently replace the body
 		hres = hfres
 	} else if !(hres.StatusCode == http.StatusOK || hres.StatusCode == http.StatusPartialContent) {
+		hres.Body.Close()
 		return nil, fmt.Errorf("error during HEAD: %d / %s", hres.StatusCode, hres.Status)
 	}
 	// POST: Either HEAD or GET RANGE succeeded in determining support for range downloads. Proceed!
 
-	if cl := hres.Header.Get("Content-Length"); cl == "" {
+	// Give the caller a chance to reject the probe before we commit to anything
+	if rt.bodyValidator != nil {
+		if verr := rt.bodyValidator(hres); verr != nil {
+			hres.Body.Close()
+			return nil, fmt.Errorf("[%s] probe response rejected by validator: %w: %w", dlid, ValidationError, verr)
+		}
+	}
+	hres.Body.Close()
+	rt.checkRedirectedLength(dlid, hres)
+
+	rs, err := probeRangeSupport(hres)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", dlid, err)
+	}
+	rt.DebugOut.Printf("[%s] Probe of %s: ranges %t, total %d\n", dlid, rs.finalURL, rs.ok, rs.total)
+	unranged := "ranges unsupported"
+	if enc := compressed(hres); rs.ok && enc != "" {
+		// Ranges of what was sent aren't ranges of the content, so don't fire off requests for them
+		if rt.requiresRanges() {
+			return nil, fmt.Errorf("[%s] probe of %s is %s encoded: %w: %w", dlid, r.URL, enc, CompressedRangeError, RangesUnsupportedError)
+		}
+		rs.ok = false
+		unranged = fmt.Sprintf("probe is %s encoded", enc)
+	}
+	if !rs.ok && rt.assumeRanges && hres.Header.Get("Accept-Ranges") != "none" {
+		// Many servers support ranges without saying so, so ask for one and see
+		pres, perr := rt.tryHeadFake(r.URL.String())
+		if perr != nil {
+			rt.DebugOut.Printf("[%s] Ranges assumed, but the ranged GET failed: %v\n", dlid, perr)
+		} else if pres.StatusCode == http.StatusOK {
+			// It gave us the whole file, so we are done
+			if rt.rangeCache != nil {
+				rt.rangeCache.Set(r.URL.Host, false)
+			}
+			rt.fallback(dlid, "ranges assumed, but a ranged GET returned the whole content")
+			return pres, nil
+		} else if prs, perr := probeRangeSupport(pres); perr == nil && prs.total > 0 {
+			pres.Body.Close()
+			rt.DebugOut.Printf("[%s] Ranges assumed, and a ranged GET confirmed them, total %d\n", dlid, prs.total)
+			hres, rs = pres, prs
+		} else {
+			pres.Body.Close()
+		}
+	}
+	if rt.rangeCache != nil {
+		rt.rangeCache.Set(r.URL.Host, rs.ok)
+	}
+	rt.rangesOK = rs.ok
+
+	if err = rt.checkLength(r.URL.String(), rs.total); err != nil {
+		return nil, fmt.Errorf("[%s] %w", dlid, err)
+	}
+	if rt.knownSize > 0 {
+		// We were told how big it is, so that's authoritative
+		if rs.total >= 0 && rs.total != rt.knownSize {
+			rt.DebugOut.Printf("[%s] Content-Length %d differs from known size %d, using known size\n", dlid, rs.total, rt.knownSize)
+		}
+		rs.total = rt.knownSize
+	} else if rs.total < 0 && rt.requiresRanges() {
+		return nil, fmt.Errorf("[%s] no Content-Length from %s: %w", dlid, r.URL, UnknownSizeError)
+	} else if rs.total < 0 {
 		// No Content-Length? Just grab it like normal :(
+		rt.fallback(dlid, "no Content-Length")
 		if err = rt.fetch(r.URL.String()); err != nil {
 			return nil, err
 		}
 		return hres, nil
-	} else if contentLength, err = strconv.Atoi(cl); err != nil {
-		// Non-numeric content-length? Bail.
-		return nil, fmt.Errorf("[%s] value of Content-Length header appears non-numeric: '%s': %w", dlid, cl, ContentLengthNumericError)
+	}
+	contentLength = rs.total
+	rt.ifRange = ifRangeFor(r, hres)
+
+	ranged := rs.ok
+	if !ranged && rt.requiresRanges() {
+		return nil, fmt.Errorf("[%s] Accept-Ranges '%s' from %s: %w", dlid, hres.Header.Get("Accept-Ranges"), r.URL, RangesUnsupportedError)
+	} else if ranged && !rt.requiresRanges() && contentLength < rt.threshold {
+		// Small enough that the extra requests would cost more than they save
+		rt.fallback(dlid, fmt.Sprintf("Content-Length %d is below the parallel threshold %d", contentLength, rt.threshold))
+		ranged = false
 	}
 
-	// Byte ranges accepted? Let's do this
-	if v := hres.Header.Get("Accept-Ranges"); v == "bytes" {
-		var (
-			start     int
-			end       int
-			chunkSize = int(contentLength / rt.workers)
-		)
-		if rt.chunkSize != 0 {
-			chunkSize = int(rt.chunkSize)
-			rt.workers = int(contentLength / chunkSize)
+	if ranged {
+		// Chunks are written wherever they belong, in whatever order they arrive
+		if err = rt.checkSeekable(); err != nil {
+			return nil, fmt.Errorf("[%s] %w", dlid, err)
+		}
+	}
+
+	if ranged && len(rt.ranges) > 0 {
+		// Only some of it, please
+		if err = rt.fetchRanges(dlid, r, contentLength); err != nil {
+			return nil, err
 		}
+		return hres, nil
+	}
 
-		if rt.progress != nil {
-			rt.progress <- int64(contentLength)
+	// Byte ranges accepted? Let's do this
+	if ranged {
+		var offset int64
+		if rt.reusing {
+			// Carrying on from the last attempt, which decided where to start
+			offset = rt.reuseFrom
+		} else if rt.resume && rt.pieceHashes != nil {
+			// Pieces are only fetched whole, so start over
+			if err = rt.resetOutput(); err != nil {
+				return nil, err
+			}
+		} else if rt.resume {
+			if offset, err = rt.resumeOffset(r, hres, contentLength); err != nil {
+				return nil, err
+			}
+			rt.DebugOut.Printf("[%s] Resuming from %d\n", dlid, offset)
 		}
+		rt.reuseFrom = offset
+		// Derived for this attempt only, so a restart starts from the settings again
+		workers, setSize := rt.planFromProbe(dlid, hres)
+		remaining := contentLength - offset
+		rt.expected.Store(contentLength)
+		rt.received.Store(offset)
+
+		chunkSize := remaining / int64(workers)
+		planSize := rt.sizeChunks(remaining, setSize)
+		if planSize != 0 && !rt.customPlan() {
+			if planSize != setSize {
+				rt.DebugOut.Printf("[%s] Chunk Size %d would exceed %d chunks, or the worker bounds %d-%d, using %d\n", dlid, setSize, rt.maxChunks, rt.workersMin, rt.workersMax, planSize)
+			}
+			chunkSize = planSize
+			if workers = int(remaining / chunkSize); workers < 1 {
+				// The chunk size is more than there is, so it's all one chunk
+				workers = 1
+			}
+		}
+		rt.planned = workers
+		var chunks []Range
+		if chunks, err = rt.planFor(remaining, workers, setSize); err != nil {
+			return nil, fmt.Errorf("[%s] %w", dlid, err)
+		}
+		chunks = rt.shuffled(chunks)
+		var kept int64
+		if chunks, kept = rt.withoutCompleted(chunks, offset); kept > 0 {
+			rt.DebugOut.Printf("[%s] Keeping %d bytes completed by the last attempt\n", dlid, kept)
+			rt.received.Add(kept)
+		}
+
+		rt.reportTotal(contentLength)
+		// What was sent before is only still good if it is what we start from
+		rt.settleProgress(offset + kept)
 
-		rt.DebugOut.Printf("[%s] Ranges supported! Content Length: %d, Downloaders: %d, Chunk Size %d\n", dlid, contentLength, rt.workers, chunkSize)
+		rt.DebugOut.Printf("[%s] Ranges supported! Content Length: %d, Downloaders: %d, Chunk Size %d\n", dlid, contentLength, len(chunks), chunkSize)
+		rt.publishPlan(contentLength, offset, chunks)
 
-		for i := 0; i < rt.workers; i++ {
-			rt.sem.Lock()
+		// Chunks in flight are stopped if we bail, and waited for either way, so nothing outlives RoundTrip
+		ctx, stopChunks := context.WithCancel(r.Context())
+		defer stopChunks()
+		bail := func() {
+			stopChunks()
+			rt.wg.Wait()
+		}
+
+		rt.reportedTotal = make(chan int64, 1)
+		rt.totalReported.Store(false)
+		for i := 0; i < len(chunks); i++ {
+			chunk := chunks[i]
+			if cerr := rt.lockSem(ctx); cerr != nil {
+				if rt.stopping.Load() {
+					break
+				}
+				rt.DebugOut.Printf("\t[%s] Cancelled while spawning workers, aborting at %d\n", dlid, chunk.Start)
+				bail()
+				return nil, cerr
+			}
+			if rt.stopping.Load() {
+				rt.DebugOut.Printf("\t[%s] Shutting down, not spawning from %d\n", dlid, chunk.Start)
+				rt.sem.Unlock()
+				break
+			}
 			if ferr := rt.fetchError.Load(); ferr != nil {
+				rt.sem.Unlock()
+				bail()
+				if errors.Is(ferr, CompressedRangeError) && !rt.requiresRanges() {
+					return rt.fetchUnranged(dlid, r, hres, ferr)
+				}
 				// We've had an error, bail
-				rt.DebugOut.Printf("\t[%s] Error %v encountered while spawning workers, aborting at %d\n", dlid, ferr, start)
+				rt.DebugOut.Printf("\t[%s] Error %v encountered while spawning workers, aborting at %d\n", dlid, ferr, chunk.Start)
 				return nil, ferr
 			}
 
 			rt.wg.Add(1)
-			end = start + int(chunkSize)
-			rt.DebugOut.Printf("\t[%s] Worker from %d to %d\n", dlid, start, end)
-			go rt.fetchChunk(int64(start), int64(end), r.URL.String())
-			start = end
-		}
-		if end < contentLength {
-			// gap
-			rt.sem.Lock()
-			rt.wg.Add(1)
-			start = end
-			end = contentLength
-			rt.DebugOut.Printf("\t[%s] Gap worker from %d to %d\n", dlid, start, end)
-			go rt.fetchChunk(int64(start), int64(end), r.URL.String())
+			chunk.Start += offset
+			chunk.End += offset
+			rt.DebugOut.Printf("\t[%s] Worker from %d to %d\n", dlid, chunk.Start, chunk.End)
+			go rt.fetchChunk(ctx, chunk.Start, chunk.End, r.URL.String())
+
+			if i == 0 {
+				// Some origins disagree with themselves, so we cross-check the total the first chunk reports
+				// against what the probe said, and trust the GET if they differ.
+				if total := <-rt.reportedTotal; total > 0 && total != contentLength && rt.knownSize == 0 {
+					rt.DebugOut.Printf("\t[%s] First chunk reports total of %d, not %d. Replanning.\n", dlid, total, contentLength)
+					if lerr := rt.checkLength(r.URL.String(), total); lerr != nil {
+						bail()
+						return nil, fmt.Errorf("[%s] %w", dlid, lerr)
+					}
+					contentLength = total
+					rt.expected.Store(total)
+					chunks = chunks[:1]
+					if rt.customPlan() || rt.shuffle {
+						// Schedule the lot again, less what's already underway, which needn't be the start
+						rest, serr := rt.planFor(total-offset, workers, setSize)
+						if serr != nil {
+							bail()
+							return nil, fmt.Errorf("[%s] %w", dlid, serr)
+						}
+						chunks = append(chunks, rt.shuffled(subtractRange(rest, Range{Start: chunk.Start - offset, End: chunk.End - offset}))...)
+					} else {
+						for _, c := range planChunks(total-chunk.End, workers, rt.sizeChunks(total-chunk.End, setSize)) {
+							c.Start += chunk.End - offset
+							c.End += chunk.End - offset
+							chunks = append(chunks, c)
+						}
+					}
+					rt.publishPlan(total, offset, chunks)
+				}
+			}
 		}
 		rt.wg.Wait() // wrap in a timer?
+		rt.result.Ranged = true
+		rt.result.Chunks = len(chunks)
+
+		if rt.stopping.Load() {
+			return nil, rt.checkpoint(dlid, offset, contentLength, hres.Header.Get("ETag"))
+		}
 
 		if ferr := rt.fetchError.Load(); ferr != nil {
+			if errors.Is(ferr, CompressedRangeError) && !rt.requiresRanges() {
+				return rt.fetchUnranged(dlid, r, hres, ferr)
+			}
 			// We've had an error, bail
 			rt.DebugOut.Printf("[%s] Error %v encountered after all workers spawned, aborting\n", dlid, ferr)
 			return nil, ferr
 		}
+		if err := rt.checkTotals(contentLength); err != nil {
+			return nil, fmt.Errorf("[%s] %w", dlid, err)
+		}
 
 		rt.DebugOut.Printf("[%s] complete\n", dlid)
 		defer timings.Track(fmt.Sprintf("[%s] RangeTripper Assembled", dlid), time.Now(), rt.TimingsOut)
@@ -272,27 +1074,124 @@ func (rt *RangeTripper) RoundTrip(r *http.Request) (*http.Response, error) {
 		if err != nil {
 			return nil, err
 		}
-		if fileSize := fileStats.Size(); fileSize != int64(contentLength) {
-			return nil, fmt.Errorf("[%s] actual Size: %d expected Size: %d : %w", dlid, fileSize, contentLength, ContentLengthMismatchError)
+		if fileSize := fileStats.Size() - rt.writeOffset; fileSize != contentLength && (rt.writeOffset == 0 || fileSize < contentLength) {
+			// Past the end of our region is someone else's
+			return nil, fmt.Errorf("[%s] %w", dlid, ContentLengthMismatchError{Expected: contentLength, Actual: fileSize})
 		}
 		return hres, nil
 	}
-	// else Byte ranges not accepted :(
-	rt.DebugOut.Printf("[%s] Range Download unsupported\nBeginning full download...\n", dlid)
+	// else Byte ranges not accepted (or not wanted) :(
+	if rs.ok {
+		rt.DebugOut.Printf("[%s] Beginning full download...\n", dlid)
+	} else {
+		rt.fallback(dlid, unranged)
+	}
 
-	rt.fetch(r.URL.String())
+	if err = rt.fetch(r.URL.String()); err != nil {
+		return nil, err
+	}
 
 	rt.DebugOut.Printf("[%s] Download Complete\n", dlid)
 	return hres, nil
 }
 
+// fetchUnranged abandons the chunks, once those in flight are done, because of “why“, and fetches the content
+// in one go instead.
+func (rt *RangeTripper) fetchUnranged(dlid string, r *http.Request, hres *http.Response, why error) (*http.Response, error) {
+	rt.wg.Wait()
+	rt.fetchError.Store(nil)
+	rt.reportedTotal = nil
+	rt.resetTotals()
+	rt.result.Ranged = false
+	rt.result.Chunks = 0
+
+	rt.fallback(dlid, why.Error())
+	if err := rt.fetch(r.URL.String()); err != nil {
+		return nil, err
+	}
+	return hres, nil
+}
+
+// compressed returns the encoding of the Response's content, if it's anything but the identity, as when a
+// server compresses on the fly, whatever was asked for.
+func compressed(res *http.Response) string {
+	if enc := res.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return enc
+	}
+	for _, te := range res.TransferEncoding {
+		if !strings.EqualFold(te, "chunked") && !strings.EqualFold(te, "identity") {
+			return te
+		}
+	}
+	return ""
+}
+
+// forCall returns a RangeTripper with the same settings, but a download of its own, to “path“
+func (rt *RangeTripper) forCall(path string) *RangeTripper {
+	c := *rt
+	c.download = newDownload(rt.maxWorkers)
+	c.toFile = path
+	c.perCall = true
+	return &c
+}
+
 // Do is a satisfier of the rangetripper.Client interface, and is identical to RoundTrip
 func (rt *RangeTripper) Do(r *http.Request) (*http.Response, error) {
 	return rt.RoundTrip(r)
 }
 
+// fallback logs, and reports to any SetOnFallback function, that the download isn't going to use ranges.
+func (rt *RangeTripper) fallback(dlid, reason string) {
+	rt.DebugOut.Printf("[%s] Range Download unsupported: %s\nBeginning full download...\n", dlid, reason)
+	if rt.onFallback != nil {
+		rt.onFallback(reason)
+	}
+}
+
+// checkRedirectedLength logs if any response in the redirect chain that led to “res“ reported a different
+// Content-Length than “res“ itself. The final response is what was actually served, so it is always the one
+// planned from, but an origin and its CDN disagreeing is worth knowing about.
+func (rt *RangeTripper) checkRedirectedLength(dlid string, res *http.Response) {
+	final := res.Header.Get("Content-Length")
+	if final == "" || res.Request == nil {
+		return
+	}
+
+	for prev := res.Request.Response; prev != nil; {
+		if cl := prev.Header.Get("Content-Length"); cl != "" && cl != final {
+			rt.DebugOut.Printf("[%s] Content-Length %s from %s differs from %s after redirect to %s, using %s\n",
+				dlid, cl, prev.Request.URL, final, res.Request.URL, final)
+		}
+		if prev.Request == nil {
+			break
+		}
+		prev = prev.Request.Response
+	}
+}
+
+// do counts the Request, and makes it with the specified Client, through any SetTransportChain middlewares
+func (rt *RangeTripper) do(c Client, req *http.Request) (*http.Response, error) {
+	rt.requests.Inc()
+	start := time.Now()
+	req = req.WithContext(rt.withConnCounting(withRequestCounter(req.Context(), &rt.requests)))
+	stats := RetryStats{Attempts: 1}
+	res, err := rt.dispatch(c, req, &stats)
+	rt.recordTrace(req, res, err, start, stats.Attempts)
+	if err != nil && stats.StatusCode == http.StatusForbidden {
+		// So it can be told apart from other statuses a RetryClient doesn't think worth retrying
+		err = fmt.Errorf("%w: %w", err, ForbiddenError)
+	}
+	return res, err
+}
+
+// RequestCount returns the number of HTTP requests made so far, including the probe and any retries made by
+// this RangeTripper or a RetryClient it uses.
+func (rt *RangeTripper) RequestCount() int64 {
+	return rt.requests.Load()
+}
+
 // head returns the Response or error from a HEAD request for the specified URL
-func (rt *RangeTripper) head(url string) (*http.Response, error) {
+func (rt *RangeTripper) head(ctx context.Context, url string) (*http.Response, error) {
 	var (
 		req *http.Request
 		res *http.Response
@@ -302,18 +1201,18 @@ func (rt *RangeTripper) head(url string) (*http.Response, error) {
 	defer timings.Track("head", time.Now(), rt.TimingsOut)
 
 	// Create a simple HEAD request
-	if req, err = http.NewRequest("HEAD", url, nil); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, "HEAD", url, nil); err != nil {
 		return nil, err
 	}
 
-	if res, err = http.DefaultClient.Do(req); err != nil {
+	if res, err = rt.do(rt.client, req); err != nil {
 		return nil, err
 	}
 	return res, nil
 }
 
 // headFake returns the Response or error from a GET request with a small RANGE
-func (rt *RangeTripper) headFake(url string) (*http.Response, error) {
+func (rt *RangeTripper) headFake(ctx context.Context, url string) (*http.Response, error) {
 	var (
 		req   *http.Request
 		res   *http.Response
@@ -321,17 +1220,25 @@ func (rt *RangeTripper) headFake(url string) (*http.Response, error) {
 		start int64 = 0
 		end   int64 = 10
 	)
+	if rt.minimalProbe {
+		end = 0
+	}
+	if rt.granularity > 0 {
+		// Anything less may be refused
+		end = rt.granularity - 1
+	}
 
 	defer timings.Track("headFake", time.Now(), rt.TimingsOut)
 
 	// Create a simple GET request
-	if req, err = http.NewRequest("GET", url, nil); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, "GET", url, nil); err != nil {
 		return nil, err
 	}
 
-	// Add the Range header with our details
+	// Add the Range header with our details, asking for it as is, as a range of compressed content is no use
 	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
-	if res, err = http.DefaultClient.Do(req); err != nil {
+	req.Header.Set("Accept-Encoding", "identity")
+	if res, err = rt.do(rt.client, req); err != nil {
 		return nil, err
 	}
 
@@ -349,39 +1256,128 @@ func (rt *RangeTripper) fetch(url string) error {
 		err error
 	)
 
-	if req, err = http.NewRequest("GET", url, nil); err != nil {
+	if req, err = http.NewRequestWithContext(rt.opContext(), "GET", url, nil); err != nil {
 		return err
 	}
 
-	if res, err = rt.client.Do(req); err != nil {
+	if res, err = rt.do(rt.client, req); err != nil {
 		return err
 	}
 	defer res.Body.Close()
+	if err = rt.checkLength(url, res.ContentLength); err != nil {
+		return err
+	}
 
-	if _, err = io.Copy(rt.outFile, res.Body); err != nil {
+	if err = rt.resetOutput(); err != nil {
+		return err
+	}
+	rt.startCounting(res)
+
+	var w io.Writer = rt.outFile
+	dv := newDigestVerifier(res)
+	if dv != nil {
+		w = dv.Writer(w)
+	}
+
+	var body io.Reader = &countingReader{r: rt.limitedBody(res), total: &rt.received}
+	if rt.progress != nil {
+		rt.reportTotal(res.ContentLength)
+		pr := &progressReader{r: body, report: rt.sendProgress}
+		defer pr.flush()
+		body = pr
+	}
+	var n int64
+	if n, err = io.Copy(w, body); err != nil {
 		return fmt.Errorf("error during write: %w", err)
+	} else if err = rt.checkLength(url, n); err != nil {
+		return err
+	}
+
+	// Trailers are only populated once the Body has been read
+	if dv != nil {
+		verified, verr := dv.Verify(res.Trailer)
+		if verr != nil {
+			return fmt.Errorf("verification of %s failed: %w", url, verr)
+		} else if verified {
+			rt.DebugOut.Printf("Digest trailer verified for %s\n", url)
+		}
 	}
 
 	rt.DebugOut.Printf("Finished Downloading %s\n", url)
 	return err
 }
 
+// lockSem takes a worker slot, unless the context is done first, in which case its error is returned.
+func (rt *RangeTripper) lockSem(ctx context.Context) error {
+	if ctx.Done() == nil {
+		// Can't be cancelled, so don't bother
+		rt.sem.Lock()
+		return nil
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		rt.sem.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		// Give back the slot whenever we get it
+		go func() {
+			<-locked
+			rt.sem.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// startCounting resets the count of bytes received for a single GET, whose Response says how big it is, maybe.
+func (rt *RangeTripper) startCounting(res *http.Response) {
+	rt.received.Store(0)
+	rt.settleProgress(0)
+	if res.ContentLength > 0 {
+		rt.expected.Store(res.ContentLength)
+	}
+}
+
 // fetchChunk is a range fetch-and-write func.
 // It consumes the response entirely, and assumes a WaitGroup has been Added
 // to before it is called.
-func (rt *RangeTripper) fetchChunk(start, end int64, url string) error {
+func (rt *RangeTripper) fetchChunk(ctx context.Context, start, end int64, url string) error {
 	var (
-		req *http.Request
-		res *http.Response
-		err error
+		err     error
+		ttfb    atomic.Duration
+		started = time.Now()
 	)
-
-	if rt.progress != nil {
-		defer func() { rt.progress <- end - start }()
-	}
+	ctx = withTTFB(ctx, &ttfb)
 
 	defer rt.sem.Unlock()
 	defer rt.wg.Done()
+
+	// Progress must be sent before we're Done, or RoundTrip may return before the last of it. A chunk that
+	// failed will be fetched again, or won't matter, so it isn't sent.
+	defer func() {
+		if err == nil {
+			rt.sendProgress(end - start)
+		}
+	}()
+	if rt.chunkProg != nil {
+		rt.chunkProg <- ChunkProgress{Start: start, End: end}
+		defer func() {
+			if err == nil {
+				rt.chunkProg <- ChunkProgress{Start: start, End: end, BytesDone: end - start, TTFB: ttfb.Load(), Duration: time.Since(started)}
+			}
+		}()
+	}
+
+	if rt.inFlight != nil {
+		rt.inFlight.Acquire(end - start)
+		defer rt.inFlight.Release(end - start)
+	}
+
 	defer timings.Track(fmt.Sprintf("\tfetchChunk %d - %d", start, end), time.Now(), rt.TimingsOut)
 
 	// SHOULD BE LAST of the compulsory defers, so is the first to exec before there are unlocks, etc.
@@ -389,29 +1385,174 @@ func (rt *RangeTripper) fetchChunk(start, end int64, url string) error {
 	defer func() {
 		if err != nil {
 			rt.fetchError.Store(err)
+			rt.unblockTotal()
 		}
 	}()
 
-	// Create a simple GET request
-	if req, err = http.NewRequest("GET", url, nil); err != nil {
-		return err
+	if err = rt.fetchRangeAttempts(ctx, start, end, url); err != nil && len(rt.mirrors) > 0 && ctx.Err() == nil {
+		err = rt.fetchRangeFromMirrors(ctx, start, end, url, err)
+	}
+	if err == nil {
+		rt.completedChunk(start, end)
+		rt.recordTTFB(ttfb.Load())
+	}
+	return err
+}
+
+// unblockTotal reports an unknown total, unless one has already been reported, in case a chunk failed before
+// it could report one, so the first chunk can't leave RoundTrip waiting forever for its total.
+func (rt *RangeTripper) unblockTotal() {
+	if rt.reportedTotal == nil {
+		return
+	}
+	if !rt.totalReported.Swap(true) {
+		rt.reportedTotal <- -1
+	}
+}
+
+// fetchRangeAttempts calls fetchRange, bounding each attempt by the chunk deadline, if set, and
+// retrying attempts that exceed it up to the chunk retry limit. If “parent“ is done, so are we.
+func (rt *RangeTripper) fetchRangeAttempts(parent context.Context, start, end int64, url string) error {
+	for attempt := 0; ; attempt++ {
+		url = rt.latestURL(url)
+
+		// Waiting for the host isn't held against the deadline
+		release, err := lockHost(parent, url)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(parent)
+		if rt.chunkDeadline > 0 {
+			ctx, cancel = context.WithTimeout(parent, rt.chunkDeadline)
+		}
+		err = rt.fetchRange(ctx, start, end, url)
+		cancel()
+		release()
+
+		retriable := errors.Is(err, context.DeadlineExceeded) || errors.Is(err, FirstByteTimeoutError) || errors.Is(err, PieceHashMismatchError)
+		if errors.Is(err, ForbiddenError) && rt.refresher != nil && attempt < rt.chunkRetries && parent.Err() == nil {
+			if _, rerr := rt.refreshURL(url); rerr != nil {
+				return fmt.Errorf("refreshing the URL after %w: %w", err, rerr)
+			}
+			retriable = true
+		}
+		if err == nil || !retriable || attempt >= rt.chunkRetries || parent.Err() != nil {
+			return err
+		}
+		rt.DebugOut.Printf("Range %d-%d attempt %d failed, retrying: %v\n", start, end, attempt+1, err)
+	}
+}
+
+// fetchRange requests the specified range from the url, and writes it to the outfile
+// at the appropriate offset.
+func (rt *RangeTripper) fetchRange(ctx context.Context, start, end int64, url string) (err error) {
+	var firstByte *time.Timer
+	if rt.firstByte > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		firstByte = time.AfterFunc(rt.firstByte, func() { cancel(FirstByteTimeoutError) })
 	}
 
-	// Add the Range header with our details
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
-	if res, err = rt.client.Do(req); err != nil {
+	res, err := rt.getRange(ctx, start, end, url)
+	if firstByte != nil && !firstByte.Stop() {
+		// Fired, so whatever we got is cancelled, even if it didn't know it yet
+		if err == nil {
+			res.Body.Close()
+		}
+		res, err = nil, fmt.Errorf("range %d-%d: %w", start, end, FirstByteTimeoutError)
+	}
+	if errors.Is(err, CompressedRangeError) {
+		// Recorded before the total is reported, so no more chunks are spawned
+		rt.fetchError.Store(err)
+	}
+	if rt.reportedTotal != nil {
+		// Only the first response is recorded.
+		total := int64(-1)
+		if err == nil {
+			total = contentRangeTotal(res)
+		}
+		if !rt.totalReported.Swap(true) {
+			rt.reportedTotal <- total
+		} else if expected := rt.expected.Load(); total > 0 && total < expected {
+			// Not the first, which the plan already accounts for, so anything less than planned means it shrank
+			drainAndClose(res.Body)
+			return fmt.Errorf("range %d-%d reports a total of %d, not %d: %w", start, end, total, expected, FileShrankError)
+		}
+	}
+	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
+	defer drainAndClose(res.Body)
+	rt.recordTotal(contentRangeTotal(res))
 
 	//rt.DebugOut.Printf("Range %d-%d returned %d, %s %s\n", start, end, res.StatusCode, res.Header.Get("Content-Range"), res.Header.Get("Content-Length"))
 
+	// Never take more than we asked for, in case the server ignored the Range and is sending everything
+	counted := &countingReader{r: io.LimitReader(res.Body, end-start), total: &rt.received}
+	defer func() {
+		if err != nil {
+			// It'll be fetched again, or it won't matter
+			counted.uncount()
+		}
+	}()
+	var body io.Reader = counted
+
+	// Pieces are checked as they are read, so a bad one is never taken as done
+	hasher, checkPiece := rt.pieceHasher(start, end)
+	if hasher != nil {
+		body = io.TeeReader(body, hasher)
+	}
+
+	if rt.writeBufferSize > 0 {
+		// Stream the chunk through a fixed-size buffer, writing it to the outfile at the appropriate offset
+		w := bufio.NewWriterSize(io.NewOffsetWriter(writerAtFunc(rt.writeAt), rt.writeOffset+start), rt.writeBufferSize)
+		if _, err = io.Copy(w, body); err != nil {
+			rt.DebugOut.Printf("Error during buffered copy byte %d: %s\n", start, err)
+			return err
+		} else if overran(res.Body) {
+			return fmt.Errorf("range %d-%d: %w", start, end, RangeOverrunError)
+		} else if counted.n != end-start {
+			// Short, so there would be a hole
+			return fmt.Errorf("range %d-%d: %w", start, end, ContentLengthMismatchError{Expected: end - start, Actual: counted.n})
+		} else if checkPiece != nil {
+			if err = checkPiece(); err != nil {
+				return err
+			}
+		}
+		if err = w.Flush(); err != nil {
+			rt.DebugOut.Printf("Error during flushing byte %d: %s\n", start, err)
+			return err
+		}
+
+		rt.DebugOut.Printf("Finished Downloading %d-%d: %s\n", start, end, url)
+		return nil
+	}
+
 	// Read the chunk into a buffer, and then write it to the outfile at the appropriate offset
-	var ra []byte
-	if ra, err = io.ReadAll(res.Body); err != nil {
+	buf := chunkBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			chunkBuffers.Put(buf)
+		}
+	}()
+	buf.Reset()
+
+	if _, err = buf.ReadFrom(body); err != nil {
 		rt.DebugOut.Printf("Error during ReadAll byte %d: %s\n", start, err)
 		return err
-	} else if _, err = rt.outFile.WriteAt(ra, start); err != nil {
+	} else if overran(res.Body) {
+		return fmt.Errorf("range %d-%d: %w", start, end, RangeOverrunError)
+	} else if counted.n != end-start {
+		// Short, so there would be a hole
+		return fmt.Errorf("range %d-%d: %w", start, end, ContentLengthMismatchError{Expected: end - start, Actual: counted.n})
+	} else if checkPiece != nil {
+		if err = checkPiece(); err != nil {
+			return err
+		}
+	}
+	if _, err = rt.writeAt(buf.Bytes(), rt.writeOffset+start); err != nil {
 		rt.DebugOut.Printf("Error during writing byte %d: %s\n", start, err)
 		return err
 	}
@@ -420,6 +1561,122 @@ func (rt *RangeTripper) fetchChunk(start, end int64, url string) error {
 	return nil
 }
 
+// writerAtFunc is an io.WriterAt that is just a func
+type writerAtFunc func([]byte, int64) (int, error)
+
+// WriteAt calls the func
+func (f writerAtFunc) WriteAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
+
+// writeAt writes to the output file at the offset, once there is a SetPendingWriteLimit slot for it, if any.
+func (rt *RangeTripper) writeAt(p []byte, off int64) (int, error) {
+	if rt.pendingWrites != nil {
+		rt.pendingWrites.Lock()
+		defer rt.pendingWrites.Unlock()
+	}
+	return rt.outFile.WriteAt(p, off)
+}
+
+// getRange returns the Response or error from a GET request for the specified range of the url.
+// Non-2XX responses are closed and returned as errors.
+func (rt *RangeTripper) getRange(ctx context.Context, start, end int64, url string) (*http.Response, error) {
+	var (
+		req *http.Request
+		res *http.Response
+		err error
+	)
+
+	// Create a simple GET request
+	if req, err = http.NewRequestWithContext(ctx, "GET", url, nil); err != nil {
+		return nil, err
+	}
+
+	// Add the Range header with our details, rounded to what the origin will honor, asking for it as is
+	reqStart, reqEnd := rt.alignRange(start, end)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", reqStart, reqEnd-1))
+	req.Header.Set("Accept-Encoding", "identity")
+	if rt.ifRange != "" {
+		req.Header.Set("If-Range", rt.ifRange)
+	}
+	if res, err = rt.do(rt.client, req); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// We only ask for ranges within what we were told the size was, so it must have shrunk since
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("range %d-%d: %s: %w", start, end, res.Status, FileShrankError)
+	} else if res.StatusCode == http.StatusForbidden {
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("range %d-%d: %s: %w", start, end, res.Status, ForbiddenError)
+	} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("non 2XX HTTP status received: %s", res.Status)
+	} else if res.StatusCode == http.StatusOK && rt.ifRange != "" {
+		// The validator no longer matches, so we got the whole of whatever it is now
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("range %d-%d with If-Range %s: %s: %w", start, end, rt.ifRange, res.Status, ResourceChangedError)
+	}
+
+	if enc := compressed(res); res.StatusCode == http.StatusPartialContent && enc != "" {
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("range %d-%d is %s encoded: %w", start, end, enc, CompressedRangeError)
+	} else if first := contentRangeStart(res); res.StatusCode == http.StatusPartialContent && first >= 0 && first != reqStart {
+		// Written where we asked for it to go, it would be in the wrong place
+		drainAndClose(res.Body)
+		return nil, fmt.Errorf("range %d-%d starts at %d: %w", start, end, first, RangeMisplacedError)
+	} else if res.StatusCode == http.StatusPartialContent && (reqStart != start || reqEnd != end) {
+		// Trim it back to what we asked for
+		res.Body = &trimmedBody{ReadCloser: res.Body, skip: start - reqStart, keep: end - start, trim: reqEnd - end}
+		res.ContentLength = end - start
+	}
+	return res, nil
+}
+
+// drainAndClose reads what's left of a Response Body, up to a limit, before closing it,
+// so the underlying connection can be reused for the next request.
+func drainAndClose(body io.ReadCloser) {
+	io.CopyN(io.Discard, body, maxDrainBytes)
+	body.Close()
+}
+
+// overran returns true if there is anything left to read from the Body
+func overran(body io.Reader) bool {
+	var b [1]byte
+	n, _ := io.ReadFull(body, b[:])
+	return n > 0
+}
+
+// contentRangeStart returns the first byte position from the Content-Range header of the Response, or -1 if it
+// is absent or unknown.
+func contentRangeStart(res *http.Response) int64 {
+	spec, ok := strings.CutPrefix(res.Header.Get("Content-Range"), "bytes ") // bytes 0-10/159
+	first, _, found := strings.Cut(spec, "-")
+	if !ok || !found {
+		return -1
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return -1
+	}
+	return start
+}
+
+// contentRangeTotal returns the complete length from the Content-Range header of the Response, or -1 if it
+// is absent or unknown.
+func contentRangeTotal(res *http.Response) int64 {
+	parts := strings.Split(res.Header.Get("Content-Range"), "/") // bytes 0-10/159
+	if len(parts) != 2 {
+		return -1
+	}
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || total < 0 {
+		return -1
+	}
+	return total
+}
+
 // tryHeadFake is an abstraction of logic used previously IFF a HEAD returned 403, so
 // it can now be used elsewhere. If the error is `headFakeFailedError`, that means
 // there was no error, per se, but neither were the results compelling, so you should
@@ -428,34 +1685,185 @@ func (rt *RangeTripper) tryHeadFake(url string) (*http.Response, error) {
 	// headFake returns the Response or error from a GET request with a small RANGE
 	// IFF the Response is a 206 with Content-Length and Content-Range, used in cases
 	// where a HEAD may 403 (e.g. AWS S3) but a GET works fine
-	if hfres, hferr := rt.headFake(url); hferr != nil {
+	hfres, hferr := rt.retryHeadFake(rt.opContext(), url)
+	if hferr != nil {
 		return nil, hferr
 	} else if hfres.StatusCode == http.StatusOK {
 		// 200 means it didn't accept the range, and gave us the whole file
 		defer hfres.Body.Close()
-		if _, err := io.Copy(rt.outFile, hfres.Body); err != nil {
+		if err := rt.resetOutput(); err != nil {
+			return nil, err
+		}
+		rt.startCounting(hfres)
+		if _, err := io.Copy(rt.outFile, &countingReader{r: hfres.Body, total: &rt.received}); err != nil {
 			return nil, fmt.Errorf("error during write (hf): %w", err)
 		}
 		// We done, albeit without ranges
 		return hfres, nil
 	} else if hfres.StatusCode == http.StatusPartialContent {
-		// We routed around the HEAD issue.
-
-		// Grab the size listed at the end of the Content-Range header,
-		// and force it into the Content-Length header
-		parts := strings.Split(hfres.Header.Get("Content-Range"), "/") // bytes 0-10/159
-		rt.DebugOut.Printf("%+v\n", parts)
-		if len(parts) == 2 {
-			hfres.Header.Set("Content-Length", parts[1])
-		}
-		if v := hfres.Header.Get("Accept-Ranges"); v != "bytes" {
-			hfres.Header.Set("Accept-Ranges", "bytes")
-		}
-		// Silently replacing the old Response with this one after mangling the CL header
+		// We routed around the HEAD issue. probeRangeSupport knows what to make of a 206.
 		return hfres, nil
 	} else {
 		// we should resort to returning the original error
+		rt.closeProbe(hfres)
 		return nil, headFakeFailedError
 	}
 
 }
+
+// retryHeadFake returns the Response or error from headFake, retrying errors and 5xx responses up to the
+// SetHeadFakeRetries limit.
+func (rt *RangeTripper) retryHeadFake(ctx context.Context, url string) (*http.Response, error) {
+	hfres, hferr := rt.headFake(ctx, url)
+	for i := 0; i < rt.headFakeRetries && (hferr != nil || hfres.StatusCode >= http.StatusInternalServerError); i++ {
+		if hferr != nil {
+			rt.DebugOut.Printf("HEADFAKE retry %d/%d after error: %v\n", i+1, rt.headFakeRetries, hferr)
+		} else {
+			rt.DebugOut.Printf("HEADFAKE retry %d/%d after status %d\n", i+1, rt.headFakeRetries, hfres.StatusCode)
+			rt.closeProbe(hfres)
+		}
+		hfres, hferr = rt.headFake(ctx, url)
+	}
+	return hfres, hferr
+}
+
+// closeProbe closes the Body of an unwanted probe Response, draining it first so the connection can be reused,
+// unless SetMinimalProbe says not to bother.
+func (rt *RangeTripper) closeProbe(res *http.Response) {
+	if rt.minimalProbe {
+		res.Body.Close()
+		return
+	}
+	drainAndClose(res.Body)
+}
+
+// rangeSupport is what a probe Response says about the content
+type rangeSupport struct {
+	// ok is true if the server supports byte ranges
+	ok bool
+	// total is the size of the content, or -1 if unknown
+	total int64
+	// finalURL is where the probe ended up, after any redirects
+	finalURL string
+}
+
+// probeRangeSupport returns the rangeSupport for a probe Response, be it a 200 from a HEAD, or a 206 from a
+// headFake, so every way of probing is treated the same. It errors if the size is given, but isn't a number.
+func probeRangeSupport(res *http.Response) (rangeSupport, error) {
+	rs := rangeSupport{total: -1}
+	if res.Request != nil {
+		rs.finalURL = res.Request.URL.String()
+	}
+
+	if res.StatusCode == http.StatusPartialContent {
+		// A range was asked for and honored, whatever Accept-Ranges says, and the total is in the Content-Range
+		rs.ok = true
+		rs.total = contentRangeTotal(res)
+		return rs, nil
+	}
+
+	rs.ok = res.Header.Get("Accept-Ranges") == "bytes"
+	if cl := res.Header.Get("Content-Length"); cl != "" {
+		var err error
+		if rs.total, err = strconv.ParseInt(cl, 10, 64); err != nil || rs.total < 0 {
+			return rs, InvalidContentLengthError{URL: rs.finalURL, Value: cl}
+		}
+	}
+	return rs, nil
+}
+
+// openOutput opens the output file for writing, without truncating it, in case we're resuming.
+func (rt *RangeTripper) openOutput() error {
+	var (
+		err  error
+		mode = rt.fileMode
+	)
+	if mode == 0 {
+		mode = 0666
+	}
+
+	if err = rt.confineOutput(); err != nil {
+		return err
+	}
+	if rt.outFile, err = os.OpenFile(rt.toFile, os.O_RDWR|os.O_CREATE|rt.fileFlags, mode); err != nil {
+		return err
+	}
+
+	if rt.fileMode != 0 {
+		// Explicitly set, so override the umask
+		return rt.outFile.Chmod(rt.fileMode)
+	}
+	return nil
+}
+
+// resetOutput truncates the output file, and rewinds it to the beginning, or just rewinds it to the
+// SetWriteOffset, if any. An output file that can't be rewound is left as it is.
+func (rt *RangeTripper) resetOutput() error {
+	if rt.checkSeekable() != nil {
+		// Nothing to truncate or rewind, e.g. a pipe, which is fine so long as it's written in order
+		return nil
+	}
+	rt.removeCheckpoint()
+	if rt.writeOffset > 0 {
+		// The rest of the file isn't ours to truncate
+		_, err := rt.outFile.Seek(rt.writeOffset, io.SeekStart)
+		return err
+	}
+	if err := rt.outFile.Truncate(0); err != nil {
+		return err
+	}
+	_, err := rt.outFile.Seek(0, io.SeekStart)
+	return err
+}
+
+// setFileBody replaces the Body of the Response with the output file, and makes the rest of the Response agree.
+func (rt *RangeTripper) setFileBody(res *http.Response) error {
+	f, err := os.Open(rt.toFile)
+	if err != nil {
+		return err
+	}
+	fileStats, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	res.Body = f
+	res.ContentLength = fileStats.Size()
+	res.StatusCode = http.StatusOK
+	res.Status = "200 OK"
+	res.Header.Set("Content-Length", strconv.FormatInt(fileStats.Size(), 10))
+	res.Header.Del("Content-Range")
+	return nil
+}
+
+// applyModTime sets the modification time of the output file to the Last-Modified time of the Response, if any.
+func (rt *RangeTripper) applyModTime(res *http.Response) error {
+	lm := res.Header.Get("Last-Modified")
+	if lm == "" {
+		return nil
+	}
+
+	mtime, err := http.ParseTime(lm)
+	if err != nil {
+		rt.DebugOut.Printf("Last-Modified '%s' is unparseable, not setting modification time: %s\n", lm, err)
+		return nil
+	}
+	return os.Chtimes(rt.toFile, time.Time{}, mtime)
+}
+
+// resumeOffset returns the offset a range download should resume from, given the checkpoint left by Shutdown, if
+// any, or else the size of the output file when RoundTrip started, and the probe response. If resuming isn't
+// viable, the output is reset and 0 is returned.
+func (rt *RangeTripper) resumeOffset(r *http.Request, hres *http.Response, contentLength int64) (int64, error) {
+	if etag := r.Header.Get("If-Range"); etag != "" && etag != hres.Header.Get("ETag") {
+		rt.DebugOut.Printf("ETag mismatch, not resuming: '%s' != '%s'\n", etag, hres.Header.Get("ETag"))
+		return 0, rt.resetOutput()
+	} else if offset, ok := rt.resumeCheckpoint(contentLength, hres.Header.Get("ETag")); ok {
+		// Shutdown recorded what's there
+		return offset, nil
+	} else if rt.resumeFrom > 0 && rt.resumeFrom <= contentLength {
+		return rt.resumeFrom, nil
+	}
+	return 0, rt.resetOutput()
+}
@@ -5,10 +5,22 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -145,6 +157,10 @@ func Test_RangeDownload(t *testing.T) {
 			for {
 				select {
 				case <-done:
+					// select is random, so anything still buffered must be counted too
+					for len(p) > 0 {
+						count += <-p
+					}
 					//x.Printf("\nSo %d ShouldEqual %d\n", count, contentLength)
 					x.So(count, ShouldEqual, contentLength)
 					return
@@ -201,7 +217,7 @@ func Test_RangeDownloadChunkSize(t *testing.T) {
 			fileContents, ferr := os.ReadFile(tfile.Name())
 			So(ferr, ShouldBeNil)
 			So(string(fileContents), ShouldEqual, string(serverBytes))
-			So(rt.workers, ShouldEqual, int(int64(len(serverBytes))/chunkSize))
+			So(rt.planned, ShouldEqual, int(int64(len(serverBytes))/chunkSize))
 		}
 	})
 
@@ -486,6 +502,61 @@ func Test_HEADErrorButGETRange(t *testing.T) {
 
 }
 
+func Test_HEADErrorAndFlakyGETRange(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "sdfs")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee!!!!`)
+
+	for _, retries := range []int{0, 2} {
+		var (
+			server *httptest.Server
+			fakes  int32
+		)
+
+		// Start a local HTTP server that errors on HEAD, and on the first two small ranged GETs
+		server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				server.CloseClientConnections()
+				return
+			} else if req.Header.Get("Range") == "bytes=0-10" && atomic.AddInt32(&fakes, 1) <= 2 {
+				server.CloseClientConnections()
+				return
+			}
+			http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+		}))
+
+		rt, err := New(10, tfile.Name())
+		if err != nil {
+			panic(err)
+		}
+		rt.SetClient(new(http.Client)) // no retries of its own
+		rt.SetHeadFakeRetries(retries)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		server.Close()
+
+		if retries == 0 {
+			Convey("When a server errors on HEAD and the ranged GET is flaky, without HEAD-fake retries the download fails", t, func() {
+				So(rerr, ShouldNotBeNil)
+				So(atomic.LoadInt32(&fakes), ShouldEqual, 1)
+			})
+			continue
+		}
+		Convey("When a server errors on HEAD and the ranged GET is flaky, HEAD-fake retries get past it, and it all works", t, func() {
+			So(rerr, ShouldBeNil)
+			So(atomic.LoadInt32(&fakes), ShouldEqual, 3)
+
+			fileContents, ferr := os.ReadFile(tfile.Name())
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		})
+	}
+}
+
 func Test_StandardDownloadSecondRequestFails(t *testing.T) {
 	tfile, err := os.CreateTemp("/tmp", "sd")
 	if err != nil {
@@ -520,3 +591,2062 @@ func Test_StandardDownloadSecondRequestFails(t *testing.T) {
 		})
 	})
 }
+
+func Test_RangeDownloadMaxInFlightBytes(t *testing.T) {
+
+	Convey("When a server is started that supports ranges, and max in-flight bytes is set, RangeTripper downloads the content correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		for _, max := range []int64{1, 10, 16, 1000} {
+			tfile, err := os.CreateTemp("/tmp", "rtinflight")
+			if err != nil {
+				panic(err)
+			}
+			name := tfile.Name()
+			tfile.Close()
+			defer os.Remove(name)
+
+			rt, err := New(10, name)
+			So(err, ShouldBeNil)
+			rt.SetMaxInFlightBytes(max)
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req) // Run the request
+			So(rerr, ShouldBeNil)
+
+			fileContents, ferr := os.ReadFile(name)
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+			So(rt.inFlight.inUse, ShouldEqual, 0)
+		}
+	})
+
+}
+
+func Test_BodyValidator(t *testing.T) {
+
+	Convey("When a server returns a 200 with an error page, and a body validator is set, RangeTripper rejects it before downloading", t, func() {
+		serverBytes := []byte(`{"error":"no such file"}`)
+
+		var gets int
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				gets++
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			rw.Write(serverBytes)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtvalid")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		errJSON := errors.New("got JSON, expected a file")
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetBodyValidator(func(head *http.Response) error {
+			if head.Header.Get("Content-Type") == "application/json" {
+				return errJSON
+			}
+			return nil
+		})
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldNotBeNil)
+		So(errors.Is(rerr, errJSON), ShouldBeTrue)
+		So(errors.Is(rerr, ValidationError), ShouldBeTrue)
+		So(gets, ShouldEqual, 0)
+	})
+
+}
+
+func Test_RangeDownloadResume(t *testing.T) {
+
+	Convey("When a server is started that supports ranges, and a partial file exists, RangeTripper resumes correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+		partial := 100
+
+		var lowestStart int64 = -1
+		var lock sync.Mutex
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			var start, end int64
+			if n, _ := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end); n == 2 && end > 10 {
+				lock.Lock()
+				if lowestStart < 0 || start < lowestStart {
+					lowestStart = start
+				}
+				lock.Unlock()
+			}
+			rw.Header().Set("ETag", `"v1"`)
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtresume")
+		if err != nil {
+			panic(err)
+		}
+		name := tfile.Name()
+		tfile.Close()
+		defer os.Remove(name)
+
+		So(os.WriteFile(name, serverBytes[:partial], 0600), ShouldBeNil)
+
+		rt, err := New(10, name)
+		So(err, ShouldBeNil)
+		rt.SetResumeFromFileSize(true)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		req.Header.Set("If-Range", `"v1"`)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+		So(lowestStart, ShouldEqual, partial)
+
+		fileContents, ferr := os.ReadFile(name)
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+
+		Convey("... but if the ETag doesn't match, it starts over", func() {
+			lowestStart = -1
+			So(os.WriteFile(name, []byte(`garbage garbage garbage`), 0600), ShouldBeNil)
+
+			rt, err := New(10, name)
+			So(err, ShouldBeNil)
+			rt.SetResumeFromFileSize(true)
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			req.Header.Set("If-Range", `"v0"`)
+			_, rerr := rt.RoundTrip(req)
+			So(rerr, ShouldBeNil)
+			So(lowestStart, ShouldEqual, 0)
+
+			fileContents, ferr := os.ReadFile(name)
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		})
+	})
+
+}
+
+func Test_RangeDownloadWriteBuffer(t *testing.T) {
+
+	Convey("When a server is started that supports ranges, and a write buffer size is set, RangeTripper downloads the content correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		for _, size := range []int{1, 7, 4096} {
+			tfile, err := os.CreateTemp("/tmp", "rtwbuf")
+			if err != nil {
+				panic(err)
+			}
+			name := tfile.Name()
+			tfile.Close()
+			defer os.Remove(name)
+
+			rt, err := New(10, name)
+			So(err, ShouldBeNil)
+			rt.SetWriteBufferSize(size)
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req) // Run the request
+			So(rerr, ShouldBeNil)
+
+			fileContents, ferr := os.ReadFile(name)
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		}
+	})
+
+}
+
+func Test_RetryClientContext(t *testing.T) {
+
+	Convey("When a request's context is cancelled, RetryClient stops retrying immediately", t, func() {
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		rt := NewRetryClient(10, 1*time.Second, 10*time.Millisecond) // custom RetryClient with long backoff
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+
+		start := time.Now()
+		_, rerr := rt.Do(req)
+		stop := time.Now()
+		So(rerr, ShouldNotBeNil)
+		So(stop, ShouldHappenWithin, 500*time.Millisecond, start)
+
+	})
+
+}
+
+func Test_RangeDownloadInconsistentLength(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+	for _, headLength := range []int{100, 200} {
+		headLength := headLength
+
+		Convey(fmt.Sprintf("When a server reports a Content-Length of %d on HEAD, but has %d bytes on GET, RangeTripper downloads the content correctly", headLength, len(serverBytes)), t, func() {
+
+			// Start a local HTTP server
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodHead {
+					rw.Header().Set("Accept-Ranges", "bytes")
+					rw.Header().Set("Content-Length", strconv.Itoa(headLength))
+					return
+				}
+				sbuff := bytes.NewReader(serverBytes)
+				http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+			}))
+			// Close the server when test finishes
+			defer server.Close()
+
+			tfile, err := os.CreateTemp("/tmp", "rtinconsistent")
+			if err != nil {
+				panic(err)
+			}
+			defer os.Remove(tfile.Name())
+
+			rt, err := New(10, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client)) // use a normal http.Client
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req)
+			So(rerr, ShouldBeNil)
+
+			fileContents, ferr := os.ReadFile(tfile.Name())
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		})
+	}
+
+}
+
+func Test_RangeDownloadKnownSize(t *testing.T) {
+
+	Convey("When a server supports ranges but doesn't send a Content-Length, and the size is known, RangeTripper downloads the content in chunks", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				rw.Header().Set("Accept-Ranges", "bytes")
+				return
+			}
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtknown")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetKnownSize(int64(len(serverBytes)))
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+
+		result, _ := rt.Wait()
+		So(result.Ranged, ShouldBeTrue)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+
+		Convey("... but if the known size is too big, RangeTripper returns an error", func() {
+			rt, err := New(10, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client)) // use a normal http.Client
+			rt.SetKnownSize(int64(len(serverBytes) + 5))
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req)
+			So(rerr, ShouldNotBeNil)
+		})
+	})
+
+}
+
+func Test_ConcurrentRoundTrips(t *testing.T) {
+
+	Convey("When RoundTrip is called concurrently on one RangeTripper, exactly one succeeds and the rest fail appropriately", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtconcurrent")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		var (
+			wg        sync.WaitGroup
+			errs      = make(chan error, 10)
+			successes int
+			exhausted int
+		)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+				errs <- rerr
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for rerr := range errs {
+			if rerr == nil {
+				successes++
+			} else if rerr == SingleRequestExhaustedError {
+				exhausted++
+			}
+		}
+		So(successes, ShouldEqual, 1)
+		So(exhausted, ShouldEqual, cap(errs)-1)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+
+}
+
+func Test_RangeDownloadSequentialConnectionReuse(t *testing.T) {
+
+	Convey("When chunks are downloaded one at a time, they all reuse one connection", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		var (
+			lock    sync.Mutex
+			remotes = make(map[string]int)
+		)
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Range") != "" {
+				lock.Lock()
+				remotes[req.RemoteAddr]++
+				lock.Unlock()
+			}
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtreuse")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(&http.Client{Transport: &http.Transport{}}) // a client with its own connection pool
+		rt.SetMax(1)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+
+		So(remotes, ShouldHaveLength, 1)
+		for _, count := range remotes {
+			So(count, ShouldEqual, 11)
+		}
+		So(rt.ConnStats(), ShouldResemble, ConnStats{New: 1, Reused: 11})
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+
+}
+
+func Test_RangeDownloadChunkDeadline(t *testing.T) {
+
+	Convey("When a server wedges on a chunk, and a chunk deadline is set, RangeTripper retries the chunk and downloads the content correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		var wedged atomic.Bool
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if strings.HasPrefix(req.Header.Get("Range"), "bytes=45-") && wedged.CompareAndSwap(false, true) {
+				// wedge the first attempt at the fourth chunk
+				rw.Header().Set("Content-Length", "15")
+				rw.WriteHeader(http.StatusPartialContent)
+				rw.Write(serverBytes[45:50])
+				rw.(http.Flusher).Flush()
+				select {
+				case <-req.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtdeadline")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client)) // use a normal http.Client
+		rt.SetChunkDeadline(100 * time.Millisecond)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		start := time.Now()
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+		So(time.Now(), ShouldHappenWithin, 2*time.Second, start)
+		So(wedged.Load(), ShouldBeTrue)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+
+		Convey("... but if there are no retries left, RangeTripper returns the error", func() {
+			wedged.Store(false)
+			rt, err := New(10, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client)) // use a normal http.Client
+			rt.SetChunkDeadline(100 * time.Millisecond)
+			rt.SetChunkRetries(0)
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req)
+			So(errors.Is(rerr, context.DeadlineExceeded), ShouldBeTrue)
+		})
+	})
+
+}
+
+func Test_RetryClientLogger(t *testing.T) {
+
+	Convey("When a RetryClient has a logger, each failed attempt is logged with what happens next", t, func() {
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		var buf bytes.Buffer
+		rt := NewRetryClient(2, 10*time.Millisecond, 10*time.Millisecond) // custom RetryClient with short times
+		rt.SetLogger(log.New(&buf, "", 0))
+		req, _ := http.NewRequest("GET", server.URL, nil)
+
+		_, rerr := rt.Do(req)
+		So(rerr, ShouldNotBeNil)
+
+		logged := buf.String()
+		So(logged, ShouldContainSubstring, "attempt 1/3 failed: non 2XX HTTP status received: 503 Service Unavailable, retrying in 10ms")
+		So(logged, ShouldContainSubstring, "attempt 2/3 failed")
+		So(logged, ShouldContainSubstring, "attempt 3/3 failed: non 2XX HTTP status received: 503 Service Unavailable, giving up")
+
+	})
+
+}
+
+func Test_FileModeAndFlags(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	// Start a local HTTP server
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(serverBytes) // Simple write
+	}))
+	// Close the server when test finishes
+	defer server.Close()
+
+	Convey("When a file mode is set, the output file has those permissions", t, func() {
+		dir, err := os.MkdirTemp("/tmp", "rtmode")
+		if err != nil {
+			panic(err)
+		}
+		defer os.RemoveAll(dir)
+		name := dir + "/out"
+
+		for _, mode := range []os.FileMode{0600, 0755} {
+			rt, err := New(10, name)
+			So(err, ShouldBeNil)
+			rt.SetFileMode(mode)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			fileStats, serr := os.Stat(name)
+			So(serr, ShouldBeNil)
+			So(fileStats.Mode().Perm(), ShouldEqual, mode)
+		}
+	})
+
+	Convey("When O_EXCL is set, and the output file exists, RoundTrip fails without clobbering it", t, func() {
+		tfile, err := os.CreateTemp("/tmp", "rtexcl")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+		tfile.WriteString("precious")
+		tfile.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetFileFlags(os.O_EXCL)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, os.ErrExist), ShouldBeTrue)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, "precious")
+	})
+
+	Convey("When the output directory doesn't exist, New fails early", t, func() {
+		_, err := New(10, "/tmp/does/not/exist/rtfile")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func Test_RangeDownloadRedirectedLength(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdrl")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When the probe is redirected to a server reporting a different Content-Length, the final one is used, and the difference is logged", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		cdn := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer cdn.Close()
+
+		origin := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				rw.Header().Set("Content-Length", "1000")
+			}
+			http.Redirect(rw, req, cdn.URL, http.StatusFound)
+		}))
+		defer origin.Close()
+
+		var logs bytes.Buffer
+		rt, err := NewWithLoggers(3, tfile.Name(), log.New(io.Discard, "", 0), log.New(&logs, "", 0))
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", origin.URL, nil))
+		So(rerr, ShouldBeNil)
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+		So(logs.String(), ShouldContainSubstring, "Content-Length 1000 from "+origin.URL)
+	})
+}
+
+func Test_RangeDownloadRequestCount(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdrc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, and fails a chunk once, RequestCount includes the retry", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		var failed int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if strings.HasPrefix(req.Header.Get("Range"), "bytes=0-") && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(NewRetryClient(3, time.Millisecond, time.Second))
+
+		expected := rt.ExpectedRequestCount(int64(len(serverBytes)))
+		So(expected, ShouldEqual, 6) // HEAD, four chunks, and a gap
+		So(rt.RequestCount(), ShouldEqual, 0)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(rt.RequestCount(), ShouldEqual, expected+1)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+}
+
+func Test_RangeDownloadChunkProgress(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdcp")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, and chunk progress is requested, each chunk is reported started and done", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+
+		var (
+			started  = make(map[Range]bool)
+			finished = make(map[Range]bool)
+			done     = make(chan struct{})
+		)
+		cp := rt.WithChunkProgress()
+		go func() {
+			defer close(done)
+			for p := range cp {
+				if p.BytesDone == 0 {
+					started[Range{Start: p.Start, End: p.End}] = true
+				} else {
+					finished[Range{Start: p.Start, End: p.End}] = p.BytesDone == p.End-p.Start
+				}
+			}
+		}()
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		<-done // Closed by the RangeTripper once the chunks are done
+
+		chunks := planChunks(int64(len(serverBytes)), 4, 0)
+		So(started, ShouldHaveLength, len(chunks))
+		So(finished, ShouldHaveLength, len(chunks))
+		for _, c := range chunks {
+			So(started[c], ShouldBeTrue)
+			So(finished[c], ShouldBeTrue)
+		}
+	})
+}
+
+func Test_RangeDownloadPendingWriteLimit(t *testing.T) {
+
+	Convey("When a server is started that supports ranges, and a pending write limit is set, RangeTripper downloads the content correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		for _, limit := range []int{-1, 0, 1, 3, 100} {
+			tfile, err := os.CreateTemp("/tmp", "rtpending")
+			if err != nil {
+				panic(err)
+			}
+			name := tfile.Name()
+			tfile.Close()
+			defer os.Remove(name)
+
+			for _, bufSize := range []int{0, 16} {
+				rt, err := New(10, name)
+				So(err, ShouldBeNil)
+				rt.SetPendingWriteLimit(limit)
+				rt.SetWriteBufferSize(bufSize)
+				So(rt.pendingWrites == nil, ShouldEqual, limit < 1)
+
+				req := httptest.NewRequest("GET", server.URL, nil)
+				_, rerr := rt.RoundTrip(req) // Run the request
+				So(rerr, ShouldBeNil)
+
+				fileContents, ferr := os.ReadFile(name)
+				So(ferr, ShouldBeNil)
+				So(string(fileContents), ShouldEqual, string(serverBytes))
+			}
+		}
+	})
+
+}
+
+func Test_RangeDownloadParallelThreshold(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdpt")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, RangeTripper only downloads in chunks at or above the parallel threshold", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		var ranges int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get("Range") != "" {
+				atomic.AddInt32(&ranges, 1)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		for _, tc := range []struct {
+			threshold int64
+			ranged    bool
+		}{
+			{0, true},
+			{int64(len(serverBytes)), true},
+			{int64(len(serverBytes)) + 1, false},
+		} {
+			atomic.StoreInt32(&ranges, 0)
+
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetParallelThreshold(tc.threshold)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+			So(atomic.LoadInt32(&ranges) > 0, ShouldEqual, tc.ranged)
+
+			fileContents, ferr := os.ReadFile(tfile.Name())
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		}
+	})
+}
+
+func Test_PreserveModTime(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pmt")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that provides a Last-Modified, and the modification time is preserved, the file has it", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+		modTime := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", modTime, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		for _, ranged := range []bool{true, false} {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetPreserveModTime(true)
+			if !ranged {
+				rt.SetParallelThreshold(math.MaxInt64)
+			}
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(rerr, ShouldBeNil)
+
+			fileStats, serr := os.Stat(tfile.Name())
+			So(serr, ShouldBeNil)
+			So(fileStats.ModTime().Equal(modTime), ShouldBeTrue)
+		}
+	})
+
+	Convey("When a server is started that doesn't provide a Last-Modified, and the modification time is preserved, the file is left alone", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write([]byte(`OK I have something to say here weeeeee`))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetPreserveModTime(true)
+
+		before := time.Now().Add(-time.Minute)
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		fileStats, serr := os.Stat(tfile.Name())
+		So(serr, ShouldBeNil)
+		So(fileStats.ModTime().After(before), ShouldBeTrue)
+	})
+}
+
+func Test_RequireRanges(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rr")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When ranges are required, and the server provides no Content-Length, an UnknownSizeError is returned", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Accept-Ranges", "bytes")
+			rw.Header().Set("Transfer-Encoding", "chunked")
+			if req.Method != http.MethodHead {
+				rw.Write(serverBytes)
+			}
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRequireRanges(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, UnknownSizeError), ShouldBeTrue)
+	})
+
+	Convey("When ranges are required, and the server doesn't support them, a RangesUnsupportedError is returned", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes)
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRequireRanges(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, RangesUnsupportedError), ShouldBeTrue)
+	})
+
+	Convey("When ranges are required, and the server supports them, the parallel threshold is ignored", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRequireRanges(true)
+		rt.SetParallelThreshold(math.MaxInt64)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		res, _ := rt.Wait()
+		So(res.Ranged, ShouldBeTrue)
+	})
+}
+
+func Test_PostVerify(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "pv")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that supports ranges, and a post-verifier is set, it is called with the completed file", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		errNotZip := errors.New("not a zip")
+		for _, verdict := range []error{nil, errNotZip} {
+			var verified string
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetPostVerify(func(path string) error {
+				b, _ := os.ReadFile(path)
+				verified = string(b)
+				return verdict
+			})
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(verified, ShouldEqual, string(serverBytes))
+			So(errors.Is(rerr, verdict), ShouldBeTrue)
+			So(errors.Is(rerr, ValidationError), ShouldEqual, verdict != nil)
+			_, werr := rt.Wait()
+			So(werr, ShouldEqual, rerr)
+		}
+	})
+}
+
+func Test_ProbeRangeSupport(t *testing.T) {
+
+	Convey("When probe responses are examined, HEADs and headFakes are judged the same way", t, func() {
+		probe := func(status int, headers ...string) *http.Response {
+			res := &http.Response{StatusCode: status, Header: make(http.Header), Request: httptest.NewRequest("GET", "http://example.com/final", nil)}
+			for i := 0; i < len(headers); i += 2 {
+				res.Header.Set(headers[i], headers[i+1])
+			}
+			return res
+		}
+
+		for _, tc := range []struct {
+			res   *http.Response
+			ok    bool
+			total int64
+		}{
+			{probe(http.StatusOK, "Accept-Ranges", "bytes", "Content-Length", "159"), true, 159},
+			{probe(http.StatusOK, "Content-Length", "159"), false, 159},
+			{probe(http.StatusOK, "Accept-Ranges", "bytes"), true, -1},
+			{probe(http.StatusPartialContent, "Content-Range", "bytes 0-10/159", "Content-Length", "11"), true, 159},
+			{probe(http.StatusPartialContent, "Content-Range", "bytes 0-10/*", "Content-Length", "11"), true, -1},
+		} {
+			rs, err := probeRangeSupport(tc.res)
+			So(err, ShouldBeNil)
+			So(rs.ok, ShouldEqual, tc.ok)
+			So(rs.total, ShouldEqual, tc.total)
+			So(rs.finalURL, ShouldEqual, "http://example.com/final")
+		}
+
+		_, err := probeRangeSupport(probe(http.StatusOK, "Content-Length", "lots"))
+		So(errors.Is(err, ContentLengthNumericError), ShouldBeTrue)
+
+		var icle InvalidContentLengthError
+		So(errors.As(err, &icle), ShouldBeTrue)
+		So(icle.URL, ShouldEqual, "http://example.com/final")
+		So(icle.Value, ShouldEqual, "lots")
+		So(err.Error(), ShouldContainSubstring, "http://example.com/final")
+	})
+}
+
+func Test_RangeDownloadOverrun(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdo")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When a server is started that claims to support ranges, but sends everything anyway, a RangeOverrunError is returned", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Accept-Ranges", "bytes")
+			rw.Write(serverBytes)
+		}))
+		defer server.Close()
+
+		for _, buffer := range []int{0, 4} {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetWriteBufferSize(buffer)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(errors.Is(rerr, RangeOverrunError), ShouldBeTrue)
+		}
+	})
+
+	Convey("When a server sends less of a range than was asked for, or a different one, an error is returned", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		// newServer returns a server that sends the range asked for, but “short“ bytes fewer, and “moved“ bytes on,
+		// for every range that isn't the first or the last, so the output file is still the right size
+		newServer := func(short, moved int) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Accept-Ranges", "bytes")
+				var first, last int
+				if _, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &first, &last); err != nil {
+					rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+					rw.Write(serverBytes)
+					return
+				}
+				if first > 0 && last < len(serverBytes)-1 {
+					first += moved
+					last += moved - short
+				}
+				rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(serverBytes)))
+				rw.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+				rw.WriteHeader(http.StatusPartialContent)
+				rw.Write(serverBytes[first : last+1])
+			}))
+		}
+
+		for _, tc := range []struct {
+			short, moved int
+			want         error
+		}{
+			{1, 0, ContentLengthMismatchError{}},
+			{0, -1, RangeMisplacedError},
+		} {
+			server := newServer(tc.short, tc.moved)
+			for _, buffer := range []int{0, 4} {
+				rt, err := New(4, tfile.Name())
+				So(err, ShouldBeNil)
+				rt.SetClient(new(http.Client))
+				rt.SetWriteBufferSize(buffer)
+
+				_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+				So(errors.Is(rerr, tc.want), ShouldBeTrue)
+			}
+			server.Close()
+		}
+	})
+}
+
+func Test_OnFallback(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "of")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When RoundTrip can't or won't download in chunks, the fallback function is told why", t, func() {
+		for _, tc := range []struct {
+			name      string
+			handler   http.HandlerFunc
+			threshold int64
+			reason    string
+		}{
+			{"no ranges", func(rw http.ResponseWriter, req *http.Request) {
+				rw.Write(serverBytes)
+			}, 0, "ranges unsupported"},
+			{"no Content-Length", func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Accept-Ranges", "bytes")
+				rw.Header().Set("Transfer-Encoding", "chunked")
+				if req.Method != http.MethodHead {
+					rw.Write(serverBytes)
+				}
+			}, 0, "no Content-Length"},
+			{"HEAD forbidden", func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodHead {
+					rw.WriteHeader(http.StatusForbidden)
+					return
+				}
+				rw.Write(serverBytes)
+			}, 0, "HEAD forbidden, and a ranged GET returned the whole content"},
+			{"threshold", func(rw http.ResponseWriter, req *http.Request) {
+				http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+			}, 1000, "Content-Length 39 is below the parallel threshold 1000"},
+		} {
+			server := httptest.NewServer(tc.handler)
+
+			var reasons []string
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client)) // so the probe sees the 403, rather than a RetryClient error
+			rt.SetParallelThreshold(tc.threshold)
+			rt.SetOnFallback(func(reason string) { reasons = append(reasons, reason) })
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			server.Close()
+			So(rerr, ShouldBeNil)
+			So(reasons, ShouldResemble, []string{tc.reason})
+
+			fileContents, ferr := os.ReadFile(tfile.Name())
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		}
+	})
+
+	Convey("When RoundTrip downloads in chunks, the fallback function isn't called", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		called := false
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetOnFallback(func(string) { called = true })
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(called, ShouldBeFalse)
+	})
+}
+
+func Test_RetryClientErrorClassifier(t *testing.T) {
+
+	Convey("When a RetryClient hits a certificate error, it doesn't retry", t, func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write([]byte(`OK`))
+		}))
+		defer server.Close()
+
+		var buf bytes.Buffer
+		rc := NewRetryClient(3, 10*time.Millisecond, time.Second)
+		rc.SetLogger(log.New(&buf, "", 0))
+		req, _ := http.NewRequest("GET", server.URL, nil)
+
+		_, rerr := rc.Do(req)
+		So(rerr, ShouldNotBeNil)
+		So(DefaultErrorClassifier(rerr), ShouldBeFalse)
+		So(buf.String(), ShouldContainSubstring, "attempt 1/4 failed")
+		So(buf.String(), ShouldContainSubstring, "not retrying")
+		So(buf.String(), ShouldNotContainSubstring, "attempt 2/4")
+	})
+
+	Convey("When a RetryClient has a custom error classifier, it decides what is retried", t, func() {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		rc := NewRetryClient(3, 10*time.Millisecond, time.Second)
+		rc.SetErrorClassifier(func(err error) bool {
+			return DefaultErrorClassifier(err) && !strings.Contains(err.Error(), "503")
+		})
+		req, _ := http.NewRequest("GET", server.URL, nil)
+
+		_, rerr := rc.Do(req)
+		So(rerr, ShouldNotBeNil)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 1)
+
+		rc.SetErrorClassifier(nil)
+		_, rerr = rc.Do(req)
+		So(rerr, ShouldNotBeNil)
+		So(atomic.LoadInt32(&hits), ShouldEqual, 5)
+	})
+}
+
+func Test_RangeDownloadCancelWhileSpawning(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rdcs")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When the request is cancelled while workers are waiting to be spawned, RoundTrip returns promptly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				// Wedge until the client gives up
+				<-req.Context().Done()
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil).WithContext(ctx))
+		So(errors.Is(rerr, context.Canceled), ShouldBeTrue)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+	})
+
+	Convey("When waiting for a worker slot, cancellation is noticed without one coming free", t, func() {
+		rt, err := New(1, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(1)
+		rt.sem.Lock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		So(rt.lockSem(ctx), ShouldEqual, context.DeadlineExceeded)
+
+		// The abandoned attempt gives the slot back once it gets it, so it can be had again
+		rt.sem.Unlock()
+		So(rt.lockSem(context.Background()), ShouldBeNil)
+	})
+}
+
+func Test_RangeDownloadFirstByteTimeout(t *testing.T) {
+
+	Convey("When a server doesn't answer a chunk, and a first byte timeout is set, RangeTripper retries the chunk and downloads the content correctly", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+		var silent atomic.Bool
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if strings.HasPrefix(req.Header.Get("Range"), "bytes=45-") && silent.CompareAndSwap(false, true) {
+				// say nothing to the first attempt at the fourth chunk
+				select {
+				case <-req.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtfirstbyte")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client)) // use a normal http.Client
+		rt.SetFirstByteTimeout(100 * time.Millisecond)
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		start := time.Now()
+		_, rerr := rt.RoundTrip(req)
+		So(rerr, ShouldBeNil)
+		So(time.Now(), ShouldHappenWithin, 2*time.Second, start)
+		So(silent.Load(), ShouldBeTrue)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+
+		Convey("... but if there are no retries left, RangeTripper returns a FirstByteTimeoutError", func() {
+			silent.Store(false)
+			rt, err := New(10, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client)) // use a normal http.Client
+			rt.SetFirstByteTimeout(100 * time.Millisecond)
+			rt.SetChunkRetries(0)
+
+			req := httptest.NewRequest("GET", server.URL, nil)
+			_, rerr := rt.RoundTrip(req)
+			So(errors.Is(rerr, FirstByteTimeoutError), ShouldBeTrue)
+		})
+	})
+
+}
+
+func Test_FileBody(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "fb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When the output file is used as the Body, the Response can be read like any other", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		for _, threshold := range []int64{0, math.MaxInt64} {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetFileBody(true)
+			rt.SetParallelThreshold(threshold)
+
+			client := &http.Client{Transport: rt}
+			res, rerr := client.Get(server.URL)
+			So(rerr, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, http.StatusOK)
+			So(res.ContentLength, ShouldEqual, len(serverBytes))
+
+			body, berr := io.ReadAll(res.Body)
+			So(berr, ShouldBeNil)
+			So(string(body), ShouldEqual, string(serverBytes))
+			So(res.Body.Close(), ShouldBeNil)
+		}
+	})
+}
+
+func Test_SetMax(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "sm")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	// slots returns how many worker slots can be taken before one has to be waited for
+	slots := func(rt *RangeTripper) int {
+		n := 0
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			err := rt.lockSem(ctx)
+			cancel()
+			if err != nil {
+				return n
+			}
+			n++
+		}
+	}
+
+	Convey("When SetMax is used, it sets the number of worker slots exactly, whatever the number of chunks", t, func() {
+		for _, tc := range []struct {
+			max   int
+			slots int
+		}{
+			{-1, 5},
+			{0, 5},
+			{1, 1},
+			{4, 4},
+			{5, 5},
+			{6, 6},
+			{40, 40},
+		} {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetMax(tc.max)
+			So(rt.maxWorkers, ShouldEqual, tc.slots)
+			So(rt.workers, ShouldEqual, 4)
+			So(slots(rt), ShouldEqual, tc.slots)
+		}
+	})
+
+	Convey("When SetMax allows more workers than chunks, the download is unaffected", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(40)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+}
+
+func Test_ContentLengthMismatchError(t *testing.T) {
+	Convey("When a ContentLengthMismatchError is wrapped, its sizes are available with errors.As, and errors.Is matches it", t, func() {
+		err := fmt.Errorf("[abc] %w", ContentLengthMismatchError{Expected: 100, Actual: 42})
+		So(err.Error(), ShouldContainSubstring, "actual size 42, expected size 100")
+
+		var mismatch ContentLengthMismatchError
+		So(errors.As(err, &mismatch), ShouldBeTrue)
+		So(mismatch.Expected, ShouldEqual, 100)
+		So(mismatch.Actual, ShouldEqual, 42)
+
+		So(errors.Is(err, ContentLengthMismatchError{}), ShouldBeTrue)
+		So(errors.Is(err, &ContentLengthMismatchError{}), ShouldBeTrue)
+		So(errors.Is(err, ContentLengthMismatchError{Expected: 100, Actual: 42}), ShouldBeTrue)
+		So(errors.Is(err, ContentLengthMismatchError{Expected: 100, Actual: 43}), ShouldBeFalse)
+		So(errors.Is(err, ContentLengthNumericError), ShouldBeFalse)
+	})
+}
+
+func Test_RangeDownloadFileShrank(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "shrank")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	bigBytes := bytes.Repeat([]byte("a"), 400)
+	smallBytes := bytes.Repeat([]byte("b"), 300)
+
+	// newServer returns a server that serves bigBytes to the first HEAD and GET, and smallBytes after that
+	newServer := func() *httptest.Server {
+		var heads, gets int32
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			content := smallBytes
+			if req.Method == http.MethodHead && atomic.AddInt32(&heads, 1) == 1 {
+				content = bigBytes
+			} else if req.Method == http.MethodGet && atomic.AddInt32(&gets, 1) == 1 {
+				content = bigBytes
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(content))
+		}))
+	}
+
+	Convey("When a file shrinks after the download has started, it fails with a FileShrankError", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(errors.Is(rerr, FileShrankError), ShouldBeTrue)
+	})
+
+	Convey("When a file shrinks after the download has started, and restarts are allowed, the new file is downloaded", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetShrinkRestarts(1)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, smallBytes)
+	})
+
+	Convey("When a file shrinks, and it's a later chunk that says so, restarts are still allowed", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, FileShrankError), ShouldBeTrue)
+
+		server = newServer()
+		defer server.Close()
+
+		rt, err = New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetShrinkRestarts(1)
+		progress := NewProgressAccumulator(rt.WithProgress())
+
+		_, rerr = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, smallBytes)
+
+		// What the first attempt sent was taken back
+		progress.Wait()
+		So(progress.Received(), ShouldEqual, len(smallBytes))
+	})
+
+	Convey("When a download with exclusive file flags restarts, the file it created is reused", t, func() {
+		server := newServer()
+		defer server.Close()
+
+		name := tfile.Name() + ".excl"
+		defer os.Remove(name)
+
+		rt, err := New(4, name)
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetShrinkRestarts(1)
+		rt.SetFileFlags(os.O_EXCL)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(name)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, smallBytes)
+	})
+
+	Convey("When a download with a chunk size larger than the content restarts, it is planned again from the settings", t, func() {
+		var gets int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet && atomic.AddInt32(&gets, 1) == 1 {
+				rw.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(smallBytes)))
+				rw.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(smallBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(new(http.Client))
+		rt.SetChunkSize(int64(len(smallBytes)) * 10)
+		rt.SetShrinkRestarts(1)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(atomic.LoadInt32(&gets), ShouldEqual, 2)
+		So(rt.Config().Workers, ShouldEqual, 1)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, smallBytes)
+	})
+}
+
+func Test_ProbeCheckRedirect(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "cr")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When the Client's CheckRedirect refuses a redirect, the probe is aborted, and the redirect isn't followed", t, func() {
+		var blocked int32
+		blockedServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&blocked, 1)
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader([]byte(`You shouldn't be here`)))
+		}))
+		defer blockedServer.Close()
+
+		server := httptest.NewServer(http.RedirectHandler(blockedServer.URL, http.StatusFound))
+		defer server.Close()
+
+		refused := errors.New("redirect refused")
+		var checked int32
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(&http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				atomic.AddInt32(&checked, 1)
+				return refused
+			},
+		})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+		So(errors.Is(rerr, refused), ShouldBeTrue)
+		So(atomic.LoadInt32(&checked), ShouldBeGreaterThan, 0)
+		So(atomic.LoadInt32(&blocked), ShouldEqual, 0)
+
+		trace := rt.RequestTrace()
+		So(trace, ShouldNotBeEmpty)
+		So(trace[0].Method, ShouldEqual, http.MethodHead)
+	})
+}
+
+func Test_MinimalProbe(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "mp")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	for _, minimal := range []bool{false, true} {
+		var (
+			lock   sync.Mutex
+			ranges []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			lock.Lock()
+			ranges = append(ranges, req.Header.Get("Range"))
+			lock.Unlock()
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+
+		rt, err := New(4, tfile.Name())
+		if err != nil {
+			panic(err)
+		}
+		rt.SetClient(new(http.Client))
+		rt.SetMinimalProbe(minimal)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		server.Close()
+
+		want := "bytes=0-10"
+		if minimal {
+			want = "bytes=0-0"
+		}
+		Convey(fmt.Sprintf("When the HEAD is forbidden, and the minimal probe is %t, the ranged GET probe asks for %s, and it all works", minimal, want), t, func() {
+			So(rerr, ShouldBeNil)
+			So(ranges, ShouldNotBeEmpty)
+			So(ranges[0], ShouldEqual, want)
+
+			fileContents, ferr := os.ReadFile(tfile.Name())
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		})
+	}
+}
+
+func Test_RetryClientDoWithStats(t *testing.T) {
+
+	Convey("When a request fails twice before working, DoWithStats says it took 3 attempts, and how long", t, func() {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&calls, 1) <= 2 {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			rw.Write([]byte("Woooo"))
+		}))
+		defer server.Close()
+
+		rc := NewRetryClient(3, 10*time.Millisecond, time.Second) // custom RetryClient with short times
+		req, _ := http.NewRequest("GET", server.URL, nil)
+
+		res, stats, rerr := rc.DoWithStats(req)
+		So(rerr, ShouldBeNil)
+		res.Body.Close()
+		So(stats.Attempts, ShouldEqual, 3)
+		So(stats.Elapsed, ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+	})
+
+	Convey("When a request fails every time, DoWithStats still returns stats", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		rc := NewRetryClient(3, 10*time.Millisecond, time.Second) // custom RetryClient with short times
+		req, _ := http.NewRequest("GET", server.URL, nil)
+
+		_, stats, rerr := rc.DoWithStats(req)
+		So(rerr, ShouldEqual, errStatusNope)
+		So(stats.Attempts, ShouldEqual, 1)
+		So(stats.StatusCode, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("When a RangeTripper uses a RetryClient, the RequestTrace records the attempts of each request", t, func() {
+		tfile, err := os.CreateTemp("/tmp", "dws")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+		var heads int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead && atomic.AddInt32(&heads, 1) == 1 {
+				rw.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(NewRetryClient(3, 10*time.Millisecond, time.Second))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		trace := rt.RequestTrace()
+		So(trace[0].Method, ShouldEqual, http.MethodHead)
+		So(trace[0].Attempts, ShouldEqual, 2)
+		for _, te := range trace[1:] {
+			So(te.Attempts, ShouldEqual, 1)
+		}
+	})
+}
+
+func Test_AssumeRanges(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "ar")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee`), 10)
+
+	// newServer returns a server that doesn't advertise ranges on HEAD, with the specified Accept-Ranges, if
+	// any, and that honors them on GET if “ranges“.
+	newServer := func(acceptRanges string, ranges bool, rangeGets *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead {
+				if acceptRanges != "" {
+					rw.Header().Set("Accept-Ranges", acceptRanges)
+				}
+				rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+				return
+			} else if !ranges {
+				rw.Write(serverBytes)
+				return
+			}
+			if req.Header.Get("Range") != "" {
+				atomic.AddInt32(rangeGets, 1)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When ranges are assumed, and the server supports them without saying so, the download is ranged", t, func() {
+		var rangeGets int32
+		server := newServer("", true, &rangeGets)
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetAssumeRanges(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(atomic.LoadInt32(&rangeGets), ShouldBeGreaterThan, 4)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(fileContents, ShouldResemble, serverBytes)
+	})
+
+	Convey("When ranges are assumed, but the server answers the ranged GET with everything, that's used", t, func() {
+		var rangeGets int32
+		server := newServer("", false, &rangeGets)
+		defer server.Close()
+
+		var reasons []string
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetAssumeRanges(true)
+		rt.SetOnFallback(func(reason string) { reasons = append(reasons, reason) })
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(rt.RequestCount(), ShouldEqual, 2)
+		So(reasons, ShouldHaveLength, 1)
+		So(reasons[0], ShouldContainSubstring, "ranges assumed")
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(fileContents, ShouldResemble, serverBytes)
+	})
+
+	Convey("When ranges are assumed, but the server says Accept-Ranges: none, no ranges are asked for", t, func() {
+		var rangeGets int32
+		server := newServer("none", true, &rangeGets)
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetAssumeRanges(true)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(atomic.LoadInt32(&rangeGets), ShouldEqual, 0)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(fileContents, ShouldResemble, serverBytes)
+	})
+}
+
+func Test_ConnStatsWithClientTrace(t *testing.T) {
+
+	Convey("When the Request has a ClientTrace of its own, it still gets called, and ConnStats still counts", t, func() {
+		serverBytes := []byte(`OK I have something to say here weeeeee`)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtconns")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(&http.Client{Transport: &http.Transport{}}) // a client with its own connection pool
+
+		var gotConns int64
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) { atomic.AddInt64(&gotConns, 1) },
+		})
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil).WithContext(ctx))
+		So(rerr, ShouldBeNil)
+
+		cs := rt.ConnStats()
+		So(cs.New, ShouldBeGreaterThan, 0)
+		So(cs.New+cs.Reused, ShouldEqual, rt.RequestCount())
+		// The probe isn't made with the Request's context, but every chunk is
+		So(atomic.LoadInt64(&gotConns), ShouldEqual, rt.RequestCount()-1)
+	})
+}
+
+func Test_ValidationError(t *testing.T) {
+
+	Convey("When a validator's error is wrapped with ValidationError, errors.As still recovers it", t, func() {
+		verr := &os.PathError{Op: "scan", Path: "/tmp/x", Err: errors.New("infected")}
+		err := fmt.Errorf("post-verification of %s failed: %w: %w", "/tmp/x", ValidationError, verr)
+
+		var pe *os.PathError
+		So(errors.As(err, &pe), ShouldBeTrue)
+		So(pe, ShouldEqual, verr)
+		So(errors.Is(err, ValidationError), ShouldBeTrue)
+		So(errors.Is(err, ContentLengthNumericError), ShouldBeFalse)
+	})
+}
+
+func Test_RetryClientIdempotency(t *testing.T) {
+
+	Convey("When requests keep failing, only those that are safe to send again are retried", t, func() {
+		var (
+			calls  int32
+			bodies sync.Map
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			b, _ := io.ReadAll(req.Body)
+			bodies.Store(string(b), true)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		for _, tc := range []struct {
+			method     string
+			key        string
+			idempotent bool
+			attempts   int32
+		}{
+			{method: "GET", attempts: 3},
+			{method: "POST", attempts: 1},
+			{method: "POST", key: "Idempotency-Key", attempts: 3},
+			{method: "POST", key: "X-Idempotency-Key", attempts: 3},
+			{method: "POST", idempotent: true, attempts: 3},
+		} {
+			atomic.StoreInt32(&calls, 0)
+			bodies = sync.Map{}
+
+			rc := NewRetryClient(2, time.Millisecond, time.Second) // custom RetryClient with short times
+			rc.SetIdempotent(tc.idempotent)
+			req, _ := http.NewRequest(tc.method, server.URL, strings.NewReader("payload"))
+			if tc.key != "" {
+				req.Header.Set(tc.key, "abc123")
+			}
+
+			_, stats, rerr := rc.DoWithStats(req)
+			So(rerr, ShouldNotBeNil)
+			So(stats.Attempts, ShouldEqual, tc.attempts)
+			So(atomic.LoadInt32(&calls), ShouldEqual, tc.attempts)
+
+			// Every attempt got the whole body
+			n := 0
+			bodies.Range(func(k, v any) bool {
+				So(k, ShouldEqual, "payload")
+				n++
+				return true
+			})
+			So(n, ShouldEqual, 1)
+		}
+	})
+
+	Convey("When a request's body can't be had again, it isn't retried, even if it's idempotent", t, func() {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		rc := NewRetryClient(2, time.Millisecond, time.Second) // custom RetryClient with short times
+		rc.SetIdempotent(true)
+		req, _ := http.NewRequest("PUT", server.URL, io.NopCloser(strings.NewReader("payload")))
+
+		_, stats, rerr := rc.DoWithStats(req)
+		So(rerr, ShouldNotBeNil)
+		So(stats.Attempts, ShouldEqual, 1)
+		So(atomic.LoadInt32(&calls), ShouldEqual, 1)
+	})
+}
+
+func Test_InvalidURL(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rtiu")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When RoundTrip is handed a URL it can't download from, an InvalidURLError is returned before any request is made", t, func() {
+		for _, c := range []struct {
+			url    string
+			reason string
+		}{
+			{"/no/scheme/here", "no scheme"},
+			{"http:///no/host", "no host"},
+			{"ftp://example.com/file", "unsupported scheme 'ftp'"},
+			{"mailto:someone@example.com", "unsupported scheme 'mailto'"},
+			{"http:opaque", "no host"},
+		} {
+			u, err := url.Parse(c.url)
+			So(err, ShouldBeNil)
+
+			rt, err := New(10, tfile.Name())
+			So(err, ShouldBeNil)
+
+			_, err = rt.RoundTrip(&http.Request{Method: http.MethodGet, URL: u, Header: http.Header{}})
+			var iue InvalidURLError
+			So(errors.As(err, &iue), ShouldBeTrue)
+			So(iue.Reason, ShouldEqual, c.reason)
+			So(iue.URL, ShouldEqual, c.url)
+			So(rt.RequestCount(), ShouldEqual, 0)
+			So(rt.Err(), ShouldEqual, err)
+		}
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		_, err = rt.RoundTrip(&http.Request{Method: http.MethodGet})
+		So(err, ShouldResemble, InvalidURLError{Reason: "no URL"})
+	})
+}
+
+func Test_SpawnErrorStopsWorkers(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "rtse")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`0123456789`), 10)
+
+	Convey("When a chunk errors while workers are still being spawned, RoundTrip stops the ones in flight before returning", t, func() {
+		stalled := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			switch req.Header.Get("Range") {
+			case "bytes=10-19":
+				// Stalls until the request is abandoned
+				close(stalled)
+				select {
+				case <-req.Context().Done():
+				case <-release:
+				}
+				return
+			case "bytes=20-29":
+				<-stalled
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		var stalledDone int32
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetMax(2)
+		rt.SetTransportChain(func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				res, rerr := next.RoundTrip(req)
+				if req.Header.Get("Range") == "bytes=10-19" {
+					atomic.StoreInt32(&stalledDone, 1)
+				}
+				return res, rerr
+			})
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			done <- rerr
+		}()
+
+		select {
+		case rerr := <-done:
+			So(rerr, ShouldNotBeNil)
+			So(atomic.LoadInt32(&stalledDone), ShouldEqual, 1)
+		case <-time.After(5 * time.Second):
+			So("RoundTrip returned", ShouldEqual, "RoundTrip hung")
+		}
+	})
+}
+
+func Test_SharedRoundTrips(t *testing.T) {
+
+	Convey("When RoundTrip is called concurrently on one RangeTripper with WithOutputFile, each download is its own", t, func() {
+		serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 50)
+
+		// Start a local HTTP server
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		// Close the server when test finishes
+		defer server.Close()
+
+		tdir, err := os.MkdirTemp("/tmp", "rtshared")
+		if err != nil {
+			panic(err)
+		}
+		defer os.RemoveAll(tdir)
+
+		rt, err := New(5, filepath.Join(tdir, "own"))
+		So(err, ShouldBeNil)
+		rt.SetShuffleChunks(true)
+
+		var (
+			wg   sync.WaitGroup
+			errs = make([]error, 10)
+		)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				path := filepath.Join(tdir, strconv.Itoa(i))
+				req := httptest.NewRequest("GET", server.URL, nil)
+				_, errs[i] = rt.RoundTrip(req.WithContext(WithOutputFile(req.Context(), path)))
+			}(i)
+		}
+		wg.Wait()
+
+		for i, rerr := range errs {
+			So(rerr, ShouldBeNil)
+			fileContents, ferr := os.ReadFile(filepath.Join(tdir, strconv.Itoa(i)))
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		}
+
+		Convey("... and the RangeTripper's own download is still to be had", func() {
+			_, err := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(err, ShouldBeNil)
+			fileContents, ferr := os.ReadFile(filepath.Join(tdir, "own"))
+			So(ferr, ShouldBeNil)
+			So(string(fileContents), ShouldEqual, string(serverBytes))
+		})
+	})
+
+}
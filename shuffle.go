@@ -0,0 +1,39 @@
+package rangetripper
+
+import (
+	"math/rand"
+	"time"
+)
+
+// SetShuffleChunks sets whether the chunks of a ranged download are requested in a random order, rather than
+// the order they were planned in, for origins that throttle or flag clients that request ranges sequentially.
+// Each chunk is still written at its own offset, so the output is the same. See SetShuffleSeed to make the
+// order repeatable. Stream and WriteParts, which need the content in order, aren't affected.
+func (rt *RangeTripper) SetShuffleChunks(shuffle bool) {
+	rt.shuffle = shuffle
+}
+
+// SetShuffleSeed seeds the random order of SetShuffleChunks, which is otherwise seeded from the time, so the same
+// “seed“ and plan give the same order, e.g. for tests.
+func (rt *RangeTripper) SetShuffleSeed(seed int64) {
+	rt.shuffleSeed, rt.seeded = seed, true
+	rt.shuffler = nil
+}
+
+// shuffled returns a copy of “chunks“ in a random order if SetShuffleChunks is set, otherwise “chunks“.
+func (rt *RangeTripper) shuffled(chunks []Range) []Range {
+	if !rt.shuffle {
+		return chunks
+	}
+	if rt.shuffler == nil {
+		seed := time.Now().UnixNano()
+		if rt.seeded {
+			seed = rt.shuffleSeed
+		}
+		rt.shuffler = rand.New(rand.NewSource(seed))
+	}
+
+	out := append([]Range(nil), chunks...)
+	rt.shuffler.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
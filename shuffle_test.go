@@ -0,0 +1,92 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_ShuffleChunks(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "sc")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 40)
+
+	// download fetches the content one chunk at a time, shuffled by “seed“, returning the Ranges requested in order
+	download := func(seed int64, headLength string) ([]string, error) {
+		var (
+			lock   sync.Mutex
+			ranges []string
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodHead && headLength != "" {
+				rw.Header().Set("Accept-Ranges", "bytes")
+				rw.Header().Set("Content-Length", headLength)
+				return
+			}
+			if req.Method == http.MethodGet {
+				lock.Lock()
+				ranges = append(ranges, req.Header.Get("Range"))
+				lock.Unlock()
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(8, tfile.Name())
+		if err != nil {
+			return nil, err
+		}
+		rt.SetClient(new(http.Client))
+		rt.SetMax(1)
+		rt.SetShuffleChunks(true)
+		rt.SetShuffleSeed(seed)
+
+		_, err = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		return ranges, err
+	}
+
+	Convey("When chunks are shuffled, they are requested out of order, and the output is the same", t, func() {
+		ranges, err := download(7, "")
+		So(err, ShouldBeNil)
+		So(ranges, ShouldHaveLength, 8)
+		So(sort.StringsAreSorted(ranges), ShouldBeFalse)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+
+		Convey("... and the same seed gives the same order", func() {
+			again, err := download(7, "")
+			So(err, ShouldBeNil)
+			So(again, ShouldResemble, ranges)
+		})
+	})
+
+	Convey("When chunks are shuffled, and the first chunk reports a different size than the probe, the rest is rescheduled", t, func() {
+		_, err := download(3, "300")
+		So(err, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When chunks aren't shuffled, they are returned as is", t, func() {
+		rt, err := New(8, tfile.Name())
+		So(err, ShouldBeNil)
+		chunks := planChunks(400, 8, 0)
+		So(rt.shuffled(chunks), ShouldResemble, chunks)
+	})
+}
@@ -0,0 +1,137 @@
+package rangetripper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// ShutdownError is returned, wrapped, by a RoundTrip stopped by Shutdown
+const ShutdownError = rtError("download was shut down before it completed")
+
+// Shutdown checkpoints the download cleanly, rather than aborting it: no more chunks are started, those in
+// flight are allowed to finish, the output file is synced, and the completed chunks are recorded in a file
+// alongside it, named for it with a “.resume“ suffix, so a later RangeTripper with SetResumeFromFileSize fetches
+// only the chunks that are missing. The checkpoint file is removed once the download is complete, or started
+// over. RoundTrip then returns a wrapped ShutdownError. If “ctx“ expires first, the chunks still in flight are
+// cancelled, and left out of the checkpoint, and the context's error is returned once RoundTrip has. If RoundTrip hasn't been called yet, it
+// will return ShutdownError without doing anything.
+func (rt *RangeTripper) Shutdown(ctx context.Context) error {
+	rt.stopping.Store(true)
+	if rt.checkLock.TryLock() {
+		// Not running: either done, or it'll see we're stopping
+		rt.checkLock.Unlock()
+		return nil
+	}
+
+	select {
+	case <-rt.done:
+		return nil
+	case <-ctx.Done():
+		rt.abandonOnce.Do(func() { close(rt.abandon) })
+		<-rt.done
+		return ctx.Err()
+	}
+}
+
+// abandonable returns “r“ with a context that is cancelled if Shutdown gives up waiting, and a func to release it.
+func (rt *RangeTripper) abandonable(r *http.Request) (*http.Request, func()) {
+	ctx, cancel := context.WithCancelCause(r.Context())
+	go func() {
+		select {
+		case <-rt.abandon:
+			cancel(ShutdownError)
+		case <-ctx.Done():
+		}
+	}()
+	return r.WithContext(ctx), func() { cancel(nil) }
+}
+
+// completedChunk records that the chunk from “start“ to “end“ is in the output file.
+func (rt *RangeTripper) completedChunk(start, end int64) {
+	rt.completedLock.Lock()
+	defer rt.completedLock.Unlock()
+	rt.completed = append(rt.completed, Range{Start: start, End: end})
+}
+
+// checkpointSuffix is added to the output path to name the file a checkpoint is recorded in
+const checkpointSuffix = ".resume"
+
+// checkpointState is what a checkpoint records alongside the output file, so it can be resumed
+type checkpointState struct {
+	// Size is the size of the content being downloaded
+	Size int64 `json:"size"`
+	// ETag is the ETag header of the probe, if any
+	ETag string `json:"etag,omitempty"`
+	// Completed are the ranges of the content that are in the output file
+	Completed []Range `json:"completed"`
+}
+
+// checkpoint syncs the output file, and records the completed bytes, including any before “offset“, in the
+// checkpoint file, returning a wrapped ShutdownError, or the error that prevented the checkpoint.
+func (rt *RangeTripper) checkpoint(dlid string, offset, contentLength int64, etag string) error {
+	var completed []Range
+	if offset > 0 {
+		completed = append(completed, Range{Start: 0, End: offset})
+	}
+	rt.completedLock.Lock()
+	completed = append(completed, rt.completed...)
+	rt.completedLock.Unlock()
+	sort.Slice(completed, func(i, j int) bool { return completed[i].Start < completed[j].Start })
+
+	var done int64
+	for _, c := range completed {
+		done += c.Length()
+	}
+
+	if err := rt.outFile.Sync(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(checkpointState{Size: contentLength, ETag: etag, Completed: completed})
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(rt.toFile+checkpointSuffix, b); err != nil {
+		return err
+	}
+	rt.DebugOut.Printf("[%s] Shut down, %d bytes completed\n", dlid, done)
+	return fmt.Errorf("[%s] %w, resumable with %d of %d bytes completed", dlid, ShutdownError, done, contentLength)
+}
+
+// resumeCheckpoint returns the offset to resume from, if there is a checkpoint for the content described by
+// “contentLength“ and “etag“, having taken the completed chunks after it as kept.
+func (rt *RangeTripper) resumeCheckpoint(contentLength int64, etag string) (int64, bool) {
+	b, err := os.ReadFile(rt.toFile + checkpointSuffix)
+	if err != nil {
+		return 0, false
+	}
+	var cp checkpointState
+	if err = json.Unmarshal(b, &cp); err != nil || cp.Size != contentLength || (cp.ETag != "" && cp.ETag != etag) {
+		rt.DebugOut.Printf("Checkpoint isn't for this content, not using it: %v\n", err)
+		return 0, false
+	}
+
+	var offset int64
+	for _, c := range cp.Completed {
+		if c.Start == offset {
+			offset = c.End
+		}
+	}
+	rt.completedLock.Lock()
+	rt.completed = cp.Completed
+	rt.completedLock.Unlock()
+	rt.reusing = true
+	return offset, true
+}
+
+// removeCheckpoint removes the checkpoint file, if any, once it no longer describes the output file
+func (rt *RangeTripper) removeCheckpoint() {
+	if err := os.Remove(rt.toFile + checkpointSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		rt.DebugOut.Printf("Error removing checkpoint: %v\n", err)
+	}
+}
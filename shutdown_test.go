@@ -0,0 +1,209 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Shutdown(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "shutdown")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// gated returns a server that holds every range but the first until “gate“ is closed, and signals “arrived“
+	// as each one comes in
+	gated := func(gate <-chan struct{}, arrived chan<- struct{}) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if rng := req.Header.Get("Range"); rng != "" && !strings.HasPrefix(rng, "bytes=0-") {
+				arrived <- struct{}{}
+				select {
+				case <-gate:
+				case <-req.Context().Done():
+					return
+				}
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When a download is shut down, in-flight chunks finish, and it can be resumed from the checkpoint", t, func() {
+		gate := make(chan struct{})
+		arrived := make(chan struct{}, 10)
+		server := gated(gate, arrived)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(40)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			errs <- rerr
+		}()
+		<-arrived
+
+		shut := make(chan error, 1)
+		go func() { shut <- rt.Shutdown(context.Background()) }()
+		for !rt.stopping.Load() {
+			time.Sleep(time.Millisecond)
+		}
+		close(gate)
+
+		So(<-shut, ShouldBeNil)
+		rerr := <-errs
+		So(errors.Is(rerr, ShutdownError), ShouldBeTrue)
+		So(rt.Err(), ShouldEqual, rerr)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(len(b), ShouldBeGreaterThanOrEqualTo, 80)
+		So(len(b), ShouldBeLessThan, len(serverBytes))
+		So(len(b)%40, ShouldEqual, 0)
+		So(b, ShouldResemble, serverBytes[:len(b)])
+
+		_, err = os.Stat(tfile.Name() + checkpointSuffix)
+		So(err, ShouldBeNil)
+
+		rt, err = New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetResumeFromFileSize(true)
+
+		_, rerr = rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err = os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+
+		_, err = os.Stat(tfile.Name() + checkpointSuffix)
+		So(errors.Is(err, os.ErrNotExist), ShouldBeTrue)
+	})
+
+	Convey("When a download is shut down with a gap in the completed chunks, only the missing ones are fetched on resume", t, func() {
+		var (
+			gate    = make(chan struct{})
+			arrived = make(chan struct{}, 1)
+			gets    atomic.Int32
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				gets.Add(1)
+			}
+			if strings.HasPrefix(req.Header.Get("Range"), "bytes=40-") {
+				// Only the second chunk is held
+				arrived <- struct{}{}
+				select {
+				case <-gate:
+				case <-req.Context().Done():
+					return
+				}
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		name := tfile.Name() + ".gap"
+		defer os.Remove(name)
+
+		rt, err := New(2, name)
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(40)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			errs <- rerr
+		}()
+		<-arrived
+
+		// All but the held chunk
+		for chunks := len(serverBytes)/40 - 1; ; time.Sleep(time.Millisecond) {
+			rt.completedLock.Lock()
+			completed := len(rt.completed)
+			rt.completedLock.Unlock()
+			if completed == chunks {
+				break
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(rt.Shutdown(ctx), ShouldEqual, context.DeadlineExceeded)
+		So(errors.Is(<-errs, ShutdownError), ShouldBeTrue)
+
+		gets.Store(0)
+		rt, err = New(2, name)
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(40)
+		rt.SetResumeFromFileSize(true)
+
+		go func() {
+			<-arrived
+			close(gate)
+		}()
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(gets.Load(), ShouldEqual, 1)
+
+		b, err := os.ReadFile(name)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes)
+	})
+
+	Convey("When a shutdown's context expires, in-flight chunks are cancelled and discarded", t, func() {
+		gate := make(chan struct{})
+		arrived := make(chan struct{}, 10)
+		server := gated(gate, arrived)
+		defer server.Close()
+		defer close(gate)
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(40)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			errs <- rerr
+		}()
+		<-arrived
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		So(rt.Shutdown(ctx), ShouldEqual, context.DeadlineExceeded)
+		So(errors.Is(<-errs, ShutdownError), ShouldBeTrue)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, serverBytes[:40])
+	})
+
+	Convey("When a RangeTripper is shut down before RoundTrip, RoundTrip does nothing", t, func() {
+		server := gated(nil, nil)
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		So(rt.Shutdown(context.Background()), ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldEqual, ShutdownError)
+		So(rt.RequestCount(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,84 @@
+package rangetripper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// SetRanges limits the download to the specified Ranges of the content, fetched in parallel, one request
+// each, and written at their offsets in the output file, which is the full size of the content with holes
+// where the Ranges aren't. The server must support ranges, as with SetRequireRanges. Progress reports the
+// total of the Ranges, rather than the size of the content.
+func (rt *RangeTripper) SetRanges(ranges []Range) {
+	rt.ranges = append([]Range(nil), ranges...)
+	sort.Slice(rt.ranges, func(i, j int) bool { return rt.ranges[i].Start < rt.ranges[j].Start })
+}
+
+// requiresRanges returns true if falling back to a single GET is unacceptable
+func (rt *RangeTripper) requiresRanges() bool {
+	return rt.reqRanges || len(rt.ranges) > 0 || rt.pieceHashes != nil
+}
+
+// fetchRanges downloads the Ranges set by SetRanges, into an output file of “contentLength“ bytes.
+func (rt *RangeTripper) fetchRanges(dlid string, r *http.Request, contentLength int64) error {
+	var total int64
+	for _, c := range rt.ranges {
+		if c.Start < 0 || c.End <= c.Start || c.End > contentLength {
+			return fmt.Errorf("[%s] range %d-%d is outside of the content length %d", dlid, c.Start, c.End, contentLength)
+		}
+		total += c.Length()
+	}
+
+	// Sparse, so the Ranges can be written where they belong
+	if err := rt.sizeOutput(contentLength); err != nil {
+		return err
+	}
+
+	rt.expected.Store(total)
+	rt.reportTotal(total)
+
+	rt.DebugOut.Printf("[%s] Ranges supported! Content Length: %d, Downloading %d bytes in %d Ranges\n", dlid, contentLength, total, len(rt.ranges))
+	rt.publishPlan(contentLength, 0, rt.ranges)
+
+	// Ranges in flight are stopped if we bail, and waited for either way, so nothing outlives RoundTrip
+	ctx, stopRanges := context.WithCancel(r.Context())
+	defer stopRanges()
+
+	pending, _ := rt.withoutCompleted(rt.ranges, 0)
+	for _, c := range rt.shuffled(pending) {
+		if cerr := rt.lockSem(ctx); cerr != nil {
+			rt.DebugOut.Printf("\t[%s] Cancelled while spawning workers, aborting at %d\n", dlid, c.Start)
+			stopRanges()
+			rt.wg.Wait()
+			return cerr
+		}
+		if ferr := rt.fetchError.Load(); ferr != nil {
+			// We've had an error, bail
+			rt.DebugOut.Printf("\t[%s] Error %v encountered while spawning workers, aborting at %d\n", dlid, ferr, c.Start)
+			rt.sem.Unlock()
+			stopRanges()
+			rt.wg.Wait()
+			return ferr
+		}
+
+		rt.wg.Add(1)
+		rt.DebugOut.Printf("\t[%s] Worker from %d to %d\n", dlid, c.Start, c.End)
+		go rt.fetchChunk(ctx, c.Start, c.End, r.URL.String())
+	}
+	rt.wg.Wait()
+	rt.result.Ranged = true
+	rt.result.Chunks = len(rt.ranges)
+
+	if ferr := rt.fetchError.Load(); ferr != nil {
+		rt.DebugOut.Printf("[%s] Error %v encountered after all workers spawned, aborting\n", dlid, ferr)
+		return ferr
+	}
+	if err := rt.checkTotals(contentLength); err != nil {
+		return fmt.Errorf("[%s] %w", dlid, err)
+	}
+
+	rt.DebugOut.Printf("[%s] complete\n", dlid)
+	return nil
+}
@@ -0,0 +1,132 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_SetRanges(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "sr")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	Convey("When a server is started that supports ranges, and Ranges are set, only they are downloaded, at their offsets", t, func() {
+		var gets int
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				gets++
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRanges([]Range{{Start: 33, End: 39}, {Start: 0, End: 2}})
+
+		progress := rt.WithProgress()
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		So(<-progress, ShouldEqual, 8)
+		So(gets, ShouldEqual, 2)
+
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(fileContents, ShouldHaveLength, len(serverBytes))
+		So(string(fileContents[0:2]), ShouldEqual, "OK")
+		So(string(fileContents[33:39]), ShouldEqual, "eeeeee")
+		So(bytes.Count(fileContents[2:33], []byte{0}), ShouldEqual, 31)
+
+		res, _ := rt.Wait()
+		So(res.Chunks, ShouldEqual, 2)
+	})
+
+	Convey("When Ranges are set outside of the content, an error is returned", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRanges([]Range{{Start: 30, End: 40}})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldNotBeNil)
+	})
+
+	Convey("When Ranges are set, and the server doesn't support ranges, a RangesUnsupportedError is returned", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes)
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRanges([]Range{{Start: 0, End: 2}})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, RangesUnsupportedError), ShouldBeTrue)
+	})
+}
+
+func Test_SetRangesLargeContent(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "srl")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When the content is bigger than an int32 can count, Ranges past 4GiB land where they belong", t, func() {
+		const total = int64(5 << 30)
+		tail := []byte("the end")
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Accept-Ranges", "bytes")
+			if req.Method == http.MethodHead {
+				rw.Header().Set("Content-Length", strconv.FormatInt(total, 10))
+				return
+			}
+			var start, end int64
+			fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+			rw.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+			rw.WriteHeader(http.StatusPartialContent)
+			rw.Write(tail[start-(total-int64(len(tail))):])
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRanges([]Range{{Start: total - int64(len(tail)), End: total}})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		f, err := os.Open(tfile.Name())
+		So(err, ShouldBeNil)
+		defer f.Close()
+		stats, err := f.Stat()
+		So(err, ShouldBeNil)
+		So(stats.Size(), ShouldEqual, total)
+
+		b := make([]byte, len(tail))
+		_, err = f.ReadAt(b, total-int64(len(tail)))
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, tail)
+	})
+}
@@ -0,0 +1,213 @@
+package rangetripper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// chunkResult is the outcome of reading one chunk into memory
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// streamReader is the io.ReadCloser returned by Stream. Closing it stops any outstanding chunk fetches.
+type streamReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+// Close stops the stream, and any outstanding fetches
+func (s *streamReader) Close() error {
+	s.cancel()
+	return s.PipeReader.Close()
+}
+
+// settlingBody is the io.ReadCloser returned by Stream if the content isn't streamed in chunks. It settles the
+// download once it has been read to the end, or closed, with the first error reading it, if any.
+type settlingBody struct {
+	io.ReadCloser
+	settle func(error)
+	once   sync.Once
+}
+
+// Read reads from the Body, settling once it's done
+func (b *settlingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(func() { b.settle(nil) })
+	} else if err != nil {
+		b.once.Do(func() { b.settle(err) })
+	}
+	return n, err
+}
+
+// Close closes the Body, settling if it isn't already
+func (b *settlingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.settle(nil) })
+	return err
+}
+
+// Stream returns immediately with a reader that yields the content of the url in order, without writing to the
+// output file or holding the whole content in memory. If the server supports ranges, chunks are fetched
+// concurrently, but at most as many chunks as there are workers, and no more bytes than SetReorderBufferSize
+// allows, are held in memory waiting to be read, so a slow reader slows the download. A chunk that isn't a 206
+// of exactly the length asked for fails the read with a wrapped RangesUnsupportedError, RangeOverrunError, or
+// ContentLengthMismatchError. Otherwise
+// the Body of a simple GET is returned. Either way, the caller must Close the reader. Stream counts as the one
+// request allowed for this RangeTripper.
+func (rt *RangeTripper) Stream(ctx context.Context, url string) (io.ReadCloser, error) {
+	if l := rt.withLoggers(ctx); l != rt {
+		return l.Stream(ctx, url)
+	}
+
+	rt.checkLock.Lock()
+	defer rt.checkLock.Unlock()
+
+	if rt.used {
+		return nil, SingleRequestExhaustedError
+	}
+	rt.used = true
+	start := time.Now()
+	rt.result.URL, rt.result.FinalURL = url, url
+	settle := func(err error) {
+		rt.result.Duration = time.Since(start)
+		rt.settle(err)
+	}
+
+	var contentLength int64
+	if hres, err := rt.head(rt.opContext(), url); err == nil {
+		hres.Body.Close()
+		if hres.StatusCode == http.StatusOK && hres.Header.Get("Accept-Ranges") == "bytes" {
+			contentLength, _ = strconv.ParseInt(hres.Header.Get("Content-Length"), 10, 64)
+		}
+	}
+
+	if contentLength < 1 {
+		// No ranges, or no idea how big it is, so just stream it like normal
+		rt.DebugOut.Printf("Range Download unsupported, streaming %s\n", url)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			settle(err)
+			return nil, err
+		}
+		res, err := rt.do(rt.client, req)
+		if err != nil {
+			settle(err)
+			return nil, err
+		} else if res.StatusCode < 200 || res.StatusCode >= 300 {
+			res.Body.Close()
+			err = fmt.Errorf("non 2XX HTTP status received: %s", res.Status)
+			settle(err)
+			return nil, err
+		}
+		return &settlingBody{ReadCloser: res.Body, settle: settle}, nil
+	}
+
+	chunks := planChunks(contentLength, rt.workers, rt.chunkSizeFor(contentLength))
+	rt.DebugOut.Printf("Ranges supported! Streaming Content Length: %d, Chunks: %d\n", contentLength, len(chunks))
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	rt.result.Ranged = true
+	rt.result.Chunks = len(chunks)
+	go func() {
+		settle(rt.streamChunks(ctx, cancel, url, chunks, pw))
+	}()
+
+	return &streamReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+// streamChunks fetches the chunks, keeping at most rt.workers of them, and rt.reorderBytes of their bytes, in
+// flight or waiting, and writes them in order to the PipeWriter, which is closed when done. It returns the
+// error that stopped it, if any.
+func (rt *RangeTripper) streamChunks(ctx context.Context, cancel context.CancelFunc, url string, chunks []Range, pw *io.PipeWriter) error {
+	defer cancel()
+
+	results := make([]chan chunkResult, len(chunks))
+	launch := func(i int) {
+		results[i] = make(chan chunkResult, 1)
+		go func(c Range, result chan<- chunkResult) {
+			release, err := lockHost(ctx, url)
+			if err != nil {
+				result <- chunkResult{err: err}
+				return
+			}
+			defer release()
+
+			res, err := rt.getRange(ctx, c.Start, c.End, url)
+			if err != nil {
+				result <- chunkResult{err: err}
+				return
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusPartialContent {
+				// Whatever it is, it isn't this chunk
+				result <- chunkResult{err: fmt.Errorf("range %d-%d: %s: %w", c.Start, c.End, res.Status, RangesUnsupportedError)}
+				return
+			}
+
+			// Never take more than we asked for, and a byte more to know if there was more
+			data, err := io.ReadAll(io.LimitReader(res.Body, c.Length()+1))
+			if err == nil && int64(len(data)) > c.Length() {
+				err = fmt.Errorf("range %d-%d: %w", c.Start, c.End, RangeOverrunError)
+			} else if err == nil && int64(len(data)) != c.Length() {
+				err = fmt.Errorf("range %d-%d: %w", c.Start, c.End, ContentLengthMismatchError{Expected: c.Length(), Actual: int64(len(data))})
+			}
+			result <- chunkResult{data: data, err: err}
+		}(chunks[i], results[i])
+	}
+
+	var (
+		next     int   // the next chunk to launch
+		buffered int64 // bytes of launched chunks not yet read from the PipeReader
+	)
+	// fill launches chunks while fewer than rt.workers are outstanding beyond the first “done“, and, if the
+	// reorder buffer is bounded, while they fit in it. Anything fits in an empty buffer.
+	fill := func(done int) {
+		for next < len(chunks) && next-done < rt.workers {
+			if rt.reorderBytes > 0 && buffered > 0 && buffered+chunks[next].Length() > rt.reorderBytes {
+				return
+			}
+			buffered += chunks[next].Length()
+			launch(next)
+			next++
+		}
+	}
+	fill(0)
+
+	for i := range chunks {
+		r := <-results[i]
+		results[i] = nil
+		if r.err != nil {
+			pw.CloseWithError(r.err)
+			return r.err
+		}
+		fill(i + 1)
+
+		if _, err := pw.Write(r.data); err != nil {
+			// Reader has gone away
+			return err
+		}
+		buffered -= chunks[i].Length()
+		fill(i + 1)
+	}
+	return pw.Close()
+}
+
+// SetReorderBufferSize, if greater than 0, limits the bytes of chunks Stream holds, fetched or being fetched,
+// but not yet read, so memory is bounded by bytes as well as by the number of workers. The chunk being read
+// counts until it has been read in full. A chunk bigger than the limit is still fetched, alone.
+func (rt *RangeTripper) SetReorderBufferSize(n int64) {
+	if n < 0 {
+		n = 0
+	}
+
+	rt.reorderBytes = n
+}
@@ -0,0 +1,187 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_Stream(t *testing.T) {
+	serverBytes := []byte(`OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee OK I have something to say here weeeeee`)
+
+	Convey("When a server is started that supports ranges, Stream returns the content in order", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtstream")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(7)
+
+		body, serr := rt.Stream(context.Background(), server.URL)
+		So(serr, ShouldBeNil)
+		defer body.Close()
+
+		streamed, rerr := io.ReadAll(body)
+		So(rerr, ShouldBeNil)
+		So(string(streamed), ShouldEqual, string(serverBytes))
+
+		Convey("... and a second request fails appropriately", func() {
+			_, serr := rt.Stream(context.Background(), server.URL)
+			So(serr, ShouldEqual, SingleRequestExhaustedError)
+		})
+	})
+
+	Convey("When a server is started that doesn't support ranges, Stream returns the content", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(serverBytes) // Simple write
+		}))
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtstream")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(3, tfile.Name())
+		So(err, ShouldBeNil)
+
+		body, serr := rt.Stream(context.Background(), server.URL)
+		So(serr, ShouldBeNil)
+		defer body.Close()
+
+		streamed, rerr := io.ReadAll(body)
+		So(rerr, ShouldBeNil)
+		So(string(streamed), ShouldEqual, string(serverBytes))
+	})
+
+	Convey("When a server says it supports ranges, but doesn't send the chunks asked for, Stream returns an error", t, func() {
+		var short atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Accept-Ranges", "bytes")
+			if req.Method == http.MethodHead || !short.Load() {
+				// Everything, whatever the Range
+				rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+				rw.Write(serverBytes)
+				return
+			}
+			// Half of the first chunk, whichever one was asked for
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes 0-6/%d", len(serverBytes)))
+			rw.Header().Set("Content-Length", "3")
+			rw.WriteHeader(http.StatusPartialContent)
+			rw.Write(serverBytes[:3])
+		}))
+		defer server.Close()
+
+		for _, s := range []bool{false, true} {
+			short.Store(s)
+
+			rt, err := New(3, filepath.Join(os.TempDir(), "rtstream"))
+			So(err, ShouldBeNil)
+			rt.SetChunkSize(7)
+
+			body, serr := rt.Stream(context.Background(), server.URL)
+			So(serr, ShouldBeNil)
+
+			streamed, rerr := io.ReadAll(body)
+			body.Close()
+			if s {
+				So(errors.Is(rerr, ContentLengthMismatchError{}), ShouldBeTrue)
+			} else {
+				So(errors.Is(rerr, RangesUnsupportedError), ShouldBeTrue)
+			}
+			So(len(streamed), ShouldBeLessThan, len(serverBytes))
+		}
+	})
+
+	Convey("When a stream is closed early, it returns promptly", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			sbuff := bytes.NewReader(serverBytes)
+			http.ServeContent(rw, req, "thefile", time.Now(), sbuff)
+		}))
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtstream")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(3)
+
+		body, serr := rt.Stream(context.Background(), server.URL)
+		So(serr, ShouldBeNil)
+
+		buf := make([]byte, 2)
+		_, rerr := io.ReadFull(body, buf)
+		So(rerr, ShouldBeNil)
+		So(string(buf), ShouldEqual, "OK")
+		So(body.Close(), ShouldBeNil)
+
+		_, rerr = body.Read(buf)
+		So(rerr, ShouldNotBeNil)
+	})
+}
+
+func Test_StreamReorderBufferSize(t *testing.T) {
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	Convey("When a reorder buffer size is set, Stream fetches no more than fits until the reader catches up", t, func() {
+		var gets int32
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				atomic.AddInt32(&gets, 1)
+			}
+			http.ServeContent(rw, req, "thefile", time.Now(), bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		tfile, err := os.CreateTemp("/tmp", "rtstream")
+		if err != nil {
+			panic(err)
+		}
+		defer os.Remove(tfile.Name())
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetChunkSize(10)
+		rt.SetReorderBufferSize(25)
+
+		body, serr := rt.Stream(context.Background(), server.URL)
+		So(serr, ShouldBeNil)
+		defer body.Close()
+
+		// Nothing is read, so only what fits is fetched
+		time.Sleep(50 * time.Millisecond)
+		So(atomic.LoadInt32(&gets), ShouldEqual, 2)
+
+		streamed, rerr := io.ReadAll(body)
+		So(rerr, ShouldBeNil)
+		So(string(streamed), ShouldEqual, string(serverBytes))
+		So(atomic.LoadInt32(&gets), ShouldEqual, 40)
+	})
+}
@@ -0,0 +1,45 @@
+package rangetripper
+
+import (
+	"time"
+)
+
+// ThroughputInterval is how often a ThroughputSample is sent to a WithThroughput chan
+const ThroughputInterval = time.Second
+
+// ThroughputSample is the rate the content was received at over the last ThroughputInterval, as sent to a
+// WithThroughput chan.
+type ThroughputSample struct {
+	// At is when the sample was taken
+	At time.Time
+	// BytesPerSecond is the rate the content was received at since the last sample
+	BytesPerSecond float64
+	// Received is how many bytes of the content had been received, and Total how many there are, or -1 if
+	// that isn't known (yet)
+	Received int64
+	Total    int64
+}
+
+// WithThroughput returns a read-only chan that will provide a ThroughputSample every ThroughputInterval while
+// RoundTrip is running, and once more when it is done, ready to plot. The chan belongs to the RangeTripper, which
+// closes it when RoundTrip returns, so it can be ranged over. Unlike WithProgress, samples are dropped, rather
+// than the download waiting, if the chan isn't read.
+func (rt *RangeTripper) WithThroughput() <-chan ThroughputSample {
+	if rt.throughput == nil {
+		rt.throughput = make(chan ThroughputSample, 10)
+	}
+	return rt.throughput
+}
+
+// sendThroughput sends the progressSample to the WithThroughput chan, unless its buffer is full.
+func (rt *RangeTripper) sendThroughput(s progressSample) {
+	total := s.Total
+	if total <= 0 {
+		total = -1
+	}
+
+	select {
+	case rt.throughput <- ThroughputSample{At: time.Now(), BytesPerSecond: float64(s.BPS), Received: s.Done, Total: total}:
+	default:
+	}
+}
@@ -0,0 +1,73 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_WithThroughput(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "throughput")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 100)
+
+	Convey("When throughput is asked for, samples are sent while the download runs, and the chan is closed after", t, func() {
+		// Takes a little more than a ThroughputInterval to send it all
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+			if req.Method == http.MethodHead {
+				return
+			}
+			half := len(serverBytes) / 2
+			rw.Write(serverBytes[:half])
+			rw.(http.Flusher).Flush()
+			time.Sleep(ThroughputInterval + 200*time.Millisecond)
+			rw.Write(serverBytes[half:])
+		}))
+		defer server.Close()
+
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		throughput := rt.WithThroughput()
+		So(rt.WithThroughput(), ShouldEqual, throughput)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		var samples []ThroughputSample
+		for s := range throughput {
+			samples = append(samples, s)
+		}
+		So(len(samples), ShouldBeGreaterThanOrEqualTo, 2)
+		So(samples[0].Received, ShouldBeLessThan, len(serverBytes))
+		So(samples[0].BytesPerSecond, ShouldBeGreaterThan, 0)
+
+		last := samples[len(samples)-1]
+		So(last.Received, ShouldEqual, len(serverBytes))
+		So(last.Total, ShouldEqual, len(serverBytes))
+		So(last.At, ShouldHappenAfter, samples[0].At)
+	})
+
+	Convey("When RoundTrip fails before it starts, the throughput chan is still closed", t, func() {
+		rt, err := New(2, tfile.Name())
+		So(err, ShouldBeNil)
+		throughput := rt.WithThroughput()
+
+		_, rerr := rt.RoundTrip(&http.Request{Method: http.MethodGet})
+		So(rerr, ShouldNotBeNil)
+
+		_, open := <-throughput
+		So(open, ShouldBeFalse)
+	})
+}
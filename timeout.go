@@ -0,0 +1,44 @@
+package rangetripper
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// SetTimeout bounds the whole of RoundTrip, from the probe, through every chunk, to assembly, by “d“. If it
+// takes longer, whatever is in flight is cancelled, and RoundTrip returns a wrapped context.DeadlineExceeded.
+// This is in addition to any deadline of the Request's context, and the Client's own timeout, which only
+// bounds each request. 0 disables it.
+func (rt *RangeTripper) SetTimeout(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	rt.timeout = d
+}
+
+// withTimeout returns “r“ bounded by the SetTimeout, if any, with the probe and other requests that aren't
+// made with the Request's context bounded too, and a func to release them.
+func (rt *RangeTripper) withTimeout(r *http.Request) (*http.Request, func()) {
+	if rt.timeout == 0 {
+		return r, func() {}
+	}
+
+	deadline := time.Now().Add(rt.timeout)
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	opCtx, opCancel := context.WithDeadline(context.Background(), deadline)
+	rt.opCtx = opCtx
+	return r.WithContext(ctx), func() {
+		cancel()
+		opCancel()
+	}
+}
+
+// opContext returns the context for requests that aren't made with the Request's context, e.g. the probe.
+func (rt *RangeTripper) opContext() context.Context {
+	if rt.opCtx == nil {
+		return context.Background()
+	}
+	return rt.opCtx
+}
@@ -0,0 +1,70 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Timeout(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "timeout")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte(`OK I have something to say here weeeeee `), 10)
+
+	// stalling returns a server that never answers requests for which “stall“ is true
+	stalling := func(stall func(*http.Request) bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if stall(req) {
+				<-req.Context().Done()
+				return
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+	}
+
+	Convey("When a download finishes within the timeout, all is well", t, func() {
+		server := stalling(func(*http.Request) bool { return false })
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetTimeout(10 * time.Second)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+	})
+
+	Convey("When the probe or a chunk stalls past the timeout, the download is cancelled with DeadlineExceeded", t, func() {
+		for _, stall := range []func(*http.Request) bool{
+			func(req *http.Request) bool { return req.Method == http.MethodHead },
+			func(req *http.Request) bool { return strings.HasPrefix(req.Header.Get("Range"), "bytes=200-") },
+		} {
+			server := stalling(stall)
+
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetClient(new(http.Client))
+			rt.SetTimeout(100 * time.Millisecond)
+
+			start := time.Now()
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+			So(errors.Is(rerr, context.DeadlineExceeded), ShouldBeTrue)
+			So(rerr.Error(), ShouldContainSubstring, "within 100ms")
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+			server.Close()
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package rangetripper
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// PinMismatchError is returned, wrapped, when none of a server's certificates match a pinned public key
+const PinMismatchError = rtError("server certificate does not match any pinned public key")
+
+// SPKIFingerprint returns the base64-encoded SHA-256 hash of the certificate's Subject Public Key Info, which is
+// the form of pin NewTLSConfig expects.
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewTLSConfig returns a tls.Config requiring at least “minVersion“ (e.g. tls.VersionTLS12), and, if any
+// “pins“ are given, that one of the certificates the server presents has a public key with one of those
+// SPKIFingerprints. Pinning is in addition to the normal verification of the certificate chain. Use it with
+// RetryClient.SetTLSConfig, and give the RetryClient to RangeTripper.SetClient, so it is used for every
+// request, including the probe.
+func NewTLSConfig(minVersion uint16, pins ...string) *tls.Config {
+	config := &tls.Config{
+		MinVersion: minVersion,
+	}
+	if len(pins) == 0 {
+		return config
+	}
+
+	pinned := make(map[string]bool, len(pins))
+	for _, p := range pins {
+		pinned[p] = true
+	}
+	config.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, cert := range cs.PeerCertificates {
+			if pinned[SPKIFingerprint(cert)] {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %w", cs.ServerName, PinMismatchError)
+	}
+	return config
+}
+
+// SetTLSConfig sets the TLS configuration the RetryClient makes its requests with, on a copy of its Transport,
+// so anything else set on it, e.g. by SetMaxResponseHeaderBytes, is kept. If its Transport isn't an
+// http.Transport, it is replaced with a copy of http.DefaultTransport first. See NewTLSConfig.
+func (w *RetryClient) SetTLSConfig(config *tls.Config) {
+	t := w.transport()
+	t.TLSClientConfig = config
+	w.client.Transport = t
+}
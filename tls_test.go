@@ -0,0 +1,69 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_PinnedTLS(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "tls")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+
+	var requests int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+	}))
+	defer server.Close()
+
+	pinnedClient := func(pins ...string) *RetryClient {
+		config := NewTLSConfig(tls.VersionTLS12, pins...)
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AddCert(server.Certificate())
+
+		rc := NewRetryClient(3, time.Millisecond, time.Second)
+		rc.SetTLSConfig(config)
+		return rc
+	}
+
+	Convey("When the server's public key is pinned, RangeTripper downloads the content correctly", t, func() {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(pinnedClient("bm9wZQ==", SPKIFingerprint(server.Certificate())))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+		fileContents, ferr := os.ReadFile(tfile.Name())
+		So(ferr, ShouldBeNil)
+		So(string(fileContents), ShouldEqual, string(serverBytes))
+	})
+
+	Convey("When a different public key is pinned, nothing is requested, the probe included, and nothing is retried", t, func() {
+		atomic.StoreInt32(&requests, 0)
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetClient(pinnedClient("bm9wZQ=="))
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(errors.Is(rerr, PinMismatchError), ShouldBeTrue)
+		So(atomic.LoadInt32(&requests), ShouldEqual, 0)
+		So(rt.RequestCount(), ShouldEqual, 2) // HEAD, and headFake
+	})
+}
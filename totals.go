@@ -0,0 +1,62 @@
+package rangetripper
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TotalSizeInconsistencyError is returned, wrapped, when the chunks' Content-Range headers don't all report the
+// planned length of the content, e.g. because a load balancer is spreading them over origins with different
+// versions of it, so the output would be stitched together from more than one.
+type TotalSizeInconsistencyError struct {
+	// Expected is the planned length of the content
+	Expected int64
+	// Reported are the distinct totals the chunks reported, in ascending order
+	Reported []int64
+}
+
+// Error returns the stringified version of TotalSizeInconsistencyError
+func (e TotalSizeInconsistencyError) Error() string {
+	return fmt.Sprintf("chunks reported total sizes of %v, expected %d", e.Reported, e.Expected)
+}
+
+// recordTotal records the total a chunk's Content-Range reported, unless it is unknown (-1).
+func (rt *RangeTripper) recordTotal(total int64) {
+	if total < 0 {
+		return
+	}
+
+	rt.totalsLock.Lock()
+	defer rt.totalsLock.Unlock()
+	if rt.totals == nil {
+		rt.totals = make(map[int64]bool)
+	}
+	rt.totals[total] = true
+}
+
+// resetTotals forgets the recorded totals, when the chunks are being abandoned.
+func (rt *RangeTripper) resetTotals() {
+	rt.totalsLock.Lock()
+	defer rt.totalsLock.Unlock()
+	rt.totals = nil
+}
+
+// checkTotals returns a TotalSizeInconsistencyError if any chunk reported a total other than “expected“.
+func (rt *RangeTripper) checkTotals(expected int64) error {
+	rt.totalsLock.Lock()
+	defer rt.totalsLock.Unlock()
+
+	var (
+		reported     = make([]int64, 0, len(rt.totals))
+		inconsistent bool
+	)
+	for total := range rt.totals {
+		reported = append(reported, total)
+		inconsistent = inconsistent || total != expected
+	}
+	if !inconsistent {
+		return nil
+	}
+	sort.Slice(reported, func(i, j int) bool { return reported[i] < reported[j] })
+	return TotalSizeInconsistencyError{Expected: expected, Reported: reported}
+}
@@ -0,0 +1,88 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func Test_TotalSizeInconsistency(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "tsi")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := bytes.Repeat([]byte("0123456789"), 100)
+
+	// A server where the chunks from “from“ on come from an origin that claims the content is bigger
+	newServer := func(from int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Accept-Ranges", "bytes")
+			rh := req.Header.Get("Range")
+			if rh == "" {
+				rw.Header().Set("Content-Length", strconv.Itoa(len(serverBytes)))
+				if req.Method != http.MethodHead {
+					rw.Write(serverBytes)
+				}
+				return
+			}
+			var start, end int
+			fmt.Sscanf(rh, "bytes=%d-%d", &start, &end)
+			total := len(serverBytes)
+			if start >= from {
+				total += 10
+			}
+			rw.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, total))
+			rw.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+			rw.WriteHeader(http.StatusPartialContent)
+			rw.Write(serverBytes[start : end+1])
+		}))
+	}
+
+	Convey("When every chunk reports the same total, the download succeeds", t, func() {
+		server := newServer(len(serverBytes))
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+	})
+
+	Convey("When some chunks report a different total, a TotalSizeInconsistencyError is returned", t, func() {
+		server := newServer(500)
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		var tsie TotalSizeInconsistencyError
+		So(errors.As(rerr, &tsie), ShouldBeTrue)
+		So(tsie.Expected, ShouldEqual, len(serverBytes))
+		So(tsie.Reported, ShouldResemble, []int64{int64(len(serverBytes)), int64(len(serverBytes) + 10)})
+	})
+
+	Convey("When Ranges are set, and one reports a different total, a TotalSizeInconsistencyError is returned", t, func() {
+		server := newServer(500)
+		defer server.Close()
+
+		rt, err := New(10, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetRanges([]Range{{Start: 0, End: 100}, {Start: 600, End: 700}})
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		var tsie TotalSizeInconsistencyError
+		So(errors.As(rerr, &tsie), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,88 @@
+package rangetripper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// TraceEntry is a record of one request RangeTripper made, for RequestTrace. It is plain data, so a trace can
+// be saved as a test fixture, and replayed (see rangetrippertest.Client.Replay).
+type TraceEntry struct {
+	Method string
+	URL    string
+	// Range is the Range header of the request, if any
+	Range string
+	// Status is the status code of the Response, or 0 if there was an error
+	Status int
+	// Error is the error from the Client, if any
+	Error    string
+	Start    time.Time
+	Duration time.Duration
+	// Attempts is how many attempts the Client made, if it is a RetryClient, otherwise 1
+	Attempts int
+}
+
+// RequestTrace returns a copy of the record of every request made so far, in the order they completed. Retries
+// made within the Client, e.g. by a RetryClient, are part of the one request they retry.
+func (rt *RangeTripper) RequestTrace() []TraceEntry {
+	rt.traceLock.Lock()
+	defer rt.traceLock.Unlock()
+
+	return append([]TraceEntry(nil), rt.trace...)
+}
+
+// recordTrace adds the outcome of a request to the trace
+func (rt *RangeTripper) recordTrace(req *http.Request, res *http.Response, err error, start time.Time, attempts int) {
+	te := TraceEntry{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Range:    req.Header.Get("Range"),
+		Start:    start,
+		Duration: time.Since(start),
+		Attempts: attempts,
+	}
+	if err != nil {
+		te.Error = err.Error()
+	} else {
+		te.Status = res.StatusCode
+	}
+
+	rt.traceLock.Lock()
+	defer rt.traceLock.Unlock()
+
+	rt.trace = append(rt.trace, te)
+}
+
+// ConnStats is how the requests RangeTripper made got their connections
+type ConnStats struct {
+	// New is the number of connections that were newly dialed
+	New int64
+	// Reused is the number of connections that were reused from the Client's pool
+	Reused int64
+}
+
+// ConnStats returns how many connections the requests made so far got newly dialed, and how many were reused,
+// e.g. to see whether Transport.MaxIdleConnsPerHost is set high enough to keep the connections of every chunk.
+// Each attempt made by a RetryClient counts. Clients that don't use an http.Transport may not report either.
+func (rt *RangeTripper) ConnStats() ConnStats {
+	return ConnStats{
+		New:    rt.connNew.Load(),
+		Reused: rt.connReused.Load(),
+	}
+}
+
+// withConnCounting returns a copy of the context that counts connections into the ConnStats, along with any
+// httptrace.ClientTrace already in it.
+func (rt *RangeTripper) withConnCounting(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				rt.connReused.Inc()
+			} else {
+				rt.connNew.Inc()
+			}
+		},
+	})
+}
@@ -0,0 +1,55 @@
+package rangetripper
+
+import (
+	"go.uber.org/atomic"
+
+	"context"
+	"net/http/httptrace"
+	"sort"
+	"time"
+)
+
+// withTTFB returns a copy of the context that measures the time to first byte of each request made with it, from
+// when the request has been written to when the first byte of the response arrives, keeping the latest in
+// “ttfb“. Waiting for a connection isn't counted, so it is down to the origin alone.
+func withTTFB(ctx context.Context, ttfb *atomic.Duration) context.Context {
+	var wrote atomic.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			wrote.Store(time.Now())
+		},
+		GotFirstResponseByte: func() {
+			if w := wrote.Load(); !w.IsZero() {
+				ttfb.Store(time.Since(w))
+			}
+		},
+	})
+}
+
+// recordTTFB adds the time to first byte of a completed chunk to those summarized in the DownloadResult
+func (rt *RangeTripper) recordTTFB(ttfb time.Duration) {
+	rt.traceLock.Lock()
+	defer rt.traceLock.Unlock()
+
+	rt.ttfbs = append(rt.ttfbs, ttfb)
+}
+
+// summarizeTTFB sets the TTFB fields of the DownloadResult from the chunks that completed, if any
+func (rt *RangeTripper) summarizeTTFB() {
+	rt.traceLock.Lock()
+	defer rt.traceLock.Unlock()
+
+	n := len(rt.ttfbs)
+	if n == 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), rt.ttfbs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rt.result.TTFBMin = sorted[0]
+	rt.result.TTFBMax = sorted[n-1]
+	rt.result.TTFBMedian = sorted[n/2]
+	if n%2 == 0 {
+		rt.result.TTFBMedian = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+}
@@ -0,0 +1,66 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_TTFB(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "ttfb")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	Convey("When an origin is slow to respond to chunks, their time to first byte is reported", t, func() {
+		serverBytes := bytes.Repeat([]byte("0123456789"), 40)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodGet {
+				time.Sleep(50 * time.Millisecond)
+			}
+			http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(serverBytes))
+		}))
+		defer server.Close()
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		chunkProg := rt.WithChunkProgress()
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", server.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		var completed int
+		for len(chunkProg) > 0 {
+			if cp := <-chunkProg; cp.BytesDone > 0 {
+				completed++
+				So(cp.TTFB, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+				So(cp.Duration, ShouldBeGreaterThanOrEqualTo, cp.TTFB)
+			}
+		}
+		So(completed, ShouldEqual, 4)
+
+		res, _ := rt.Wait()
+		So(res.TTFBMin, ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+		So(res.TTFBMedian, ShouldBeGreaterThanOrEqualTo, res.TTFBMin)
+		So(res.TTFBMax, ShouldBeGreaterThanOrEqualTo, res.TTFBMedian)
+	})
+
+	Convey("When TTFBs are summarized, the median of an even number is the mean of the middle two", t, func() {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		for _, d := range []time.Duration{40, 10, 30, 20} {
+			rt.recordTTFB(d)
+		}
+		rt.summarizeTTFB()
+		So(rt.result.TTFBMin, ShouldEqual, 10)
+		So(rt.result.TTFBMedian, ShouldEqual, 25)
+		So(rt.result.TTFBMax, ShouldEqual, 40)
+	})
+}
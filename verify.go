@@ -0,0 +1,72 @@
+package rangetripper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// Verify reports whether the file at “path“ is a complete and current copy of the content at “url“, by
+// comparing its size to the Content-Length of a HEAD request, and, if the response has a Content-Digest or
+// Digest header, its hash to that. A missing file is simply not a copy. If the server provides neither a size
+// nor a digest, there is nothing to compare with, and a wrapped UnknownSizeError is returned.
+func Verify(ctx context.Context, url, path string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := defaultClient().Do(req)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error during HEAD: %d / %s", res.StatusCode, res.Status)
+	}
+
+	rs, err := probeRangeSupport(res)
+	if err != nil {
+		return false, err
+	} else if rs.total < 0 && !hasDigest(res.Header) {
+		return false, fmt.Errorf("no Content-Length or digest from %s: %w", url, UnknownSizeError)
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fileStats, err := f.Stat()
+	if err != nil {
+		return false, err
+	} else if rs.total >= 0 && fileStats.Size() != rs.total {
+		return false, nil
+	}
+
+	if !hasDigest(res.Header) {
+		return true, nil
+	}
+
+	dv := newDigestHasher()
+	if _, err = io.Copy(dv.Writer(io.Discard), f); err != nil {
+		return false, err
+	}
+	verified, err := dv.Verify(res.Header)
+	if errors.Is(err, DigestMismatchError) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else if !verified && rs.total < 0 {
+		// The digest was in an algorithm we don't hash, and there's no size, so we know nothing
+		return false, fmt.Errorf("no Content-Length or usable digest from %s: %w", url, UnknownSizeError)
+	}
+	return true, nil
+}
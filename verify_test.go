@@ -0,0 +1,78 @@
+package rangetripper
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func Test_Verify(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "vfy")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	serverBytes := []byte(`OK I have something to say here weeeeee`)
+	sum := sha256.Sum256(serverBytes)
+
+	newServer := func(headers ...string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			for i := 0; i < len(headers); i += 2 {
+				rw.Header().Set(headers[i], headers[i+1])
+			}
+		}))
+	}
+
+	Convey("When a local file is checked against a server providing a Content-Length, only its size matters", t, func() {
+		server := newServer("Content-Length", strconv.Itoa(len(serverBytes)))
+		defer server.Close()
+
+		So(os.WriteFile(tfile.Name(), serverBytes, 0600), ShouldBeNil)
+		ok, err := Verify(context.Background(), server.URL, tfile.Name())
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+
+		So(os.WriteFile(tfile.Name(), serverBytes[1:], 0600), ShouldBeNil)
+		ok, err = Verify(context.Background(), server.URL, tfile.Name())
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+
+		ok, err = Verify(context.Background(), server.URL, tfile.Name()+".nope")
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("When a local file is checked against a server providing a digest, its content matters too", t, func() {
+		server := newServer("Content-Length", strconv.Itoa(len(serverBytes)), "Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		defer server.Close()
+
+		So(os.WriteFile(tfile.Name(), serverBytes, 0600), ShouldBeNil)
+		ok, err := Verify(context.Background(), server.URL, tfile.Name())
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeTrue)
+
+		corrupt := append([]byte(nil), serverBytes...)
+		corrupt[0] = 'X'
+		So(os.WriteFile(tfile.Name(), corrupt, 0600), ShouldBeNil)
+		ok, err = Verify(context.Background(), server.URL, tfile.Name())
+		So(err, ShouldBeNil)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("When a local file is checked against a server providing nothing to compare with, an UnknownSizeError is returned", t, func() {
+		server := newServer("Transfer-Encoding", "chunked")
+		defer server.Close()
+
+		_, err := Verify(context.Background(), server.URL, tfile.Name())
+		So(errors.Is(err, UnknownSizeError), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,31 @@
+package rangetripper
+
+// SetWriteOffset sets where in the output file the content starts, so byte N of it is written at “base“ + N,
+// and several downloads can be laid out in their own regions of one preallocated file. With a write offset, the
+// output file is never truncated, as the rest of it isn't this download's, so the file need only be at least
+// “base“ plus the length of the content when the download is done. SetResumeFromFileSize doesn't apply, and
+// Shutdown syncs the file without truncating it. SetVerifyDigestHeader, SetWriteReceipt, and SetFileBody, and the
+// Size of the DownloadResult, see the whole of the output file, so are of little use alongside it. The default is 0.
+func (rt *RangeTripper) SetWriteOffset(base int64) {
+	if base < 0 {
+		base = 0
+	}
+
+	rt.writeOffset = base
+}
+
+// sizeOutput makes the output file exactly “contentLength“ bytes, or, with a SetWriteOffset, makes sure it is at
+// least big enough for that many bytes after it.
+func (rt *RangeTripper) sizeOutput(contentLength int64) error {
+	if rt.writeOffset == 0 {
+		return rt.outFile.Truncate(contentLength)
+	}
+
+	fileStats, err := rt.outFile.Stat()
+	if err != nil {
+		return err
+	} else if end := rt.writeOffset + contentLength; fileStats.Size() < end {
+		return rt.outFile.Truncate(end)
+	}
+	return nil
+}
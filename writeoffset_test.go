@@ -0,0 +1,86 @@
+package rangetripper
+
+import (
+	"bytes"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_WriteOffset(t *testing.T) {
+	tfile, err := os.CreateTemp("/tmp", "writeoffset")
+	if err != nil {
+		panic(err)
+	}
+	defer os.Remove(tfile.Name())
+
+	ranged := bytes.Repeat([]byte(`ranged content `), 20)
+	unranged := bytes.Repeat([]byte(`unranged content `), 10)
+
+	rangedServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.ServeContent(rw, req, "", time.Time{}, bytes.NewReader(ranged))
+	}))
+	defer rangedServer.Close()
+
+	unrangedServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(unranged)
+	}))
+	defer unrangedServer.Close()
+
+	Convey("When downloads have write offsets, they are written to their own regions of the file, leaving the rest alone", t, func() {
+		container := bytes.Repeat([]byte(`.`), 1000)
+		So(os.WriteFile(tfile.Name(), container, 0600), ShouldBeNil)
+
+		for _, d := range []struct {
+			url    string
+			base   int64
+			ranged bool
+		}{
+			{rangedServer.URL, 100, true},
+			{unrangedServer.URL, 600, false},
+		} {
+			rt, err := New(4, tfile.Name())
+			So(err, ShouldBeNil)
+			rt.SetWriteOffset(d.base)
+			So(rt.Config().WriteOffset, ShouldEqual, d.base)
+
+			_, rerr := rt.RoundTrip(httptest.NewRequest("GET", d.url, nil))
+			So(rerr, ShouldBeNil)
+			result, _ := rt.Wait()
+			So(result.Ranged, ShouldEqual, d.ranged)
+		}
+
+		copy(container[100:], ranged)
+		copy(container[600:], unranged)
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, string(container))
+	})
+
+	Convey("When a download with a write offset goes past the end of the file, the file grows to fit it", t, func() {
+		So(os.WriteFile(tfile.Name(), []byte(`..........`), 0600), ShouldBeNil)
+
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetWriteOffset(5)
+
+		_, rerr := rt.RoundTrip(httptest.NewRequest("GET", rangedServer.URL, nil))
+		So(rerr, ShouldBeNil)
+
+		b, err := os.ReadFile(tfile.Name())
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "....."+string(ranged))
+	})
+
+	Convey("When SetWriteOffset is given a negative offset, it is 0", t, func() {
+		rt, err := New(4, tfile.Name())
+		So(err, ShouldBeNil)
+		rt.SetWriteOffset(-10)
+		So(rt.Config().WriteOffset, ShouldEqual, 0)
+	})
+}